@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/segmentio/ksuid"
+)
+
+const benchHelp = `Measures how fast KSUIDs are generated. It prints the number of KSUIDs per
+second and percentiles of the time taken to generate one, the benchmark runs for
+the duration given by -d, or until -n KSUIDs were generated when it is set.
+
+The latency of every KSUID is measured, which slows the benchmark down by the
+cost of reading the clock.`
+
+func bench(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	var src randSource
+
+	fset := newFlagSet("bench", stderr)
+	n := fset.Int("n", 0, "The number of KSUIDs to generate, overrides -d.")
+	d := fset.Duration("d", 1*time.Second, "The duration of the benchmark.")
+	goroutines := fset.Int("goroutines", 1, "The number of goroutines generating KSUIDs concurrently.")
+	src.register(fset)
+
+	if code, ok := parseFlags(fset, args); !ok {
+		return code
+	}
+
+	if fset.NArg() != 0 || *n < 0 || *goroutines < 1 {
+		fset.Usage()
+		return 2
+	}
+
+	if !src.set() {
+		fmt.Fprintln(stderr, "Bad source of random bytes:", src.name)
+		return 2
+	}
+	defer ksuid.SetRand(nil)
+
+	results := make([]benchResult, *goroutines)
+	wg := sync.WaitGroup{}
+	start := time.Now()
+	deadline := start.Add(*d)
+
+	for i := range results {
+		count := -1
+		if *n > 0 {
+			// The remainder of the division goes to the first goroutines, the
+			// others have nothing to do when -n is lower than -goroutines.
+			count = *n / *goroutines
+			if i < *n%*goroutines {
+				count++
+			}
+			if count == 0 {
+				continue
+			}
+		}
+
+		wg.Add(1)
+		go func(r *benchResult, seed int64) {
+			defer wg.Done()
+			r.run(count, deadline, seed)
+		}(&results[i], int64(i))
+	}
+
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	total := 0
+	for _, r := range results {
+		total += r.count
+	}
+
+	plural := "s"
+	if *goroutines == 1 {
+		plural = ""
+	}
+
+	fmt.Fprintf(stdout, "%d KSUIDs in %s with %d goroutine%s and %s random bytes (%.0f KSUIDs/s)\n",
+		total, elapsed, *goroutines, plural, src.name, float64(total)/elapsed.Seconds())
+
+	if p := latencyPercentiles(results, 0.5, 0.9, 0.99, 0.999); p != nil {
+		fmt.Fprintf(stdout, "Latency: p50 %s, p90 %s, p99 %s, p99.9 %s, max %s\n", p[0], p[1], p[2], p[3], maxLatency(results))
+	}
+	return 0
+}
+
+// benchLatencySamples is the size of the sample of latencies kept by each
+// goroutine of the benchmark.
+const benchLatencySamples = 10000
+
+// benchResult holds the measures of a goroutine of the benchmark.
+type benchResult struct {
+	count   int
+	max     time.Duration
+	samples []time.Duration // uniform sample of the latencies
+}
+
+// run generates KSUIDs until n were generated, or until the deadline if n is
+// negative. The seed initializes the generator used for reservoir sampling.
+func (r *benchResult) run(n int, deadline time.Time, seed int64) {
+	prng := rand.New(rand.NewSource(seed))
+	r.samples = make([]time.Duration, 0, benchLatencySamples)
+
+	for t0 := time.Now(); (n >= 0 && r.count < n) || (n < 0 && t0.Before(deadline)); {
+		ksuid.New()
+		t1 := time.Now()
+		r.add(t1.Sub(t0), prng)
+		t0 = t1
+	}
+}
+
+func (r *benchResult) add(d time.Duration, prng *rand.Rand) {
+	r.count++
+
+	if d > r.max {
+		r.max = d
+	}
+
+	// Algorithm R: the i-th latency replaces a random sample with a
+	// probability of len(samples)/i.
+	if len(r.samples) < cap(r.samples) {
+		r.samples = append(r.samples, d)
+	} else if i := prng.Intn(r.count); i < len(r.samples) {
+		r.samples[i] = d
+	}
+}
+
+// latencyPercentiles returns the latencies at the given percentiles of the
+// results, or nil if there were no KSUIDs generated. The samples of each result
+// are weighted by the number of latencies that they represent, since the
+// goroutines may not have generated the same number of KSUIDs.
+func latencyPercentiles(results []benchResult, percentiles ...float64) []time.Duration {
+	type sample struct {
+		latency time.Duration
+		weight  float64
+	}
+
+	var samples []sample
+	total := 0.0
+
+	for _, r := range results {
+		for _, d := range r.samples {
+			samples = append(samples, sample{latency: d, weight: float64(r.count) / float64(len(r.samples))})
+		}
+		total += float64(r.count)
+	}
+
+	if len(samples) == 0 {
+		return nil
+	}
+
+	sort.Slice(samples, func(i, j int) bool { return samples[i].latency < samples[j].latency })
+	latencies := make([]time.Duration, len(percentiles))
+
+	for i, p := range percentiles {
+		sum, j := 0.0, 0
+		for ; j < len(samples)-1; j++ {
+			if sum += samples[j].weight; sum >= p*total {
+				break
+			}
+		}
+		latencies[i] = samples[j].latency
+	}
+
+	return latencies
+}
+
+func maxLatency(results []benchResult) (max time.Duration) {
+	for _, r := range results {
+		if r.max > max {
+			max = r.max
+		}
+	}
+	return
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBench(t *testing.T) {
+	for _, src := range []string{"crypto", "fast"} {
+		t.Run(src, func(t *testing.T) {
+			stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+
+			if code := bench([]string{"-n", "1001", "-goroutines", "2", "-rand", src}, nil, stdout, stderr); code != 0 {
+				t.Fatalf("bench exited with code %d: %s", code, stderr)
+			}
+
+			lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+			if len(lines) != 2 || !strings.HasPrefix(lines[0], "1001 KSUIDs in ") || !strings.HasPrefix(lines[1], "Latency: p50 ") {
+				t.Errorf("bad output:\n%s", stdout)
+			}
+		})
+	}
+}
+
+func TestBenchFewerKSUIDsThanGoroutines(t *testing.T) {
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+
+	if code := bench([]string{"-n", "1", "-goroutines", "4", "-d", "10s"}, nil, stdout, stderr); code != 0 {
+		t.Fatalf("bench exited with code %d: %s", code, stderr)
+	}
+
+	if !strings.HasPrefix(stdout.String(), "1 KSUIDs in ") {
+		t.Errorf("bad output:\n%s", stdout)
+	}
+}
+
+func TestLatencyPercentiles(t *testing.T) {
+	results := []benchResult{
+		// 1000 latencies of 1ns represented by 10 samples.
+		{count: 1000, samples: []time.Duration{1, 1, 1, 1, 1, 1, 1, 1, 1, 1}},
+		// 100 latencies of 2ns to 101ns, all sampled.
+		{count: 100},
+	}
+	for i := 0; i != 100; i++ {
+		results[1].samples = append(results[1].samples, time.Duration(i+2))
+	}
+
+	p := latencyPercentiles(results, 0.5, 0.9, 0.95, 0.99, 1)
+	expected := []time.Duration{1, 1, 46, 90, 101}
+
+	for i := range expected {
+		if p[i] != expected[i] {
+			t.Errorf("bad percentiles: expected %v but got %v", expected, p)
+			break
+		}
+	}
+
+	if p := latencyPercentiles(nil, 0.5); p != nil {
+		t.Errorf("percentiles of no latencies: %v", p)
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/segmentio/ksuid"
+)
+
+const convertHelp = `Converts KSUIDs between representations. The KSUIDs are read from the files, or
+stdin, and written in the representation given by -to. Text representations
+have one KSUID per line, raw is a sequence of 20 bytes records.
+
+A UUID is converted to the payload of a KSUID, and the other way around. The
+time of version 1 and version 7 UUIDs is used as the KSUID timestamp.`
+
+// convert reads KSUIDs in one representation from files or stdin and writes
+// them in another one.
+func convert(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fset := newFlagSet("convert", stderr)
+	from := fset.String("from", "base62", "The representation of the input, one of base62, hex, uuid, or raw.")
+	to := fset.String("to", "hex", "The representation of the output, one of base62, hex, uuid, raw, or any format of the -f flag.")
+	at := timeFlag{}
+	fset.Var(&at, "time", "The `time` of KSUIDs converted from UUIDs which do not embed one (RFC3339), defaults to now.")
+
+	if code, ok := parseFlags(fset, args); !ok {
+		return code
+	}
+
+	print, ok := outputs[*to]
+	if !ok {
+		if print, ok = printers[*to]; !ok {
+			fmt.Fprintln(stderr, "Bad output representation:", *to)
+			return 2
+		}
+	}
+
+	var parse func(string) (ksuid.KSUID, error)
+	switch *from {
+	case "base62":
+		parse = ksuid.Parse
+	case "hex":
+		parse = parseHex
+	case "uuid":
+		t := at.Time
+		if !at.set {
+			t = time.Now()
+		}
+		parse = func(s string) (ksuid.KSUID, error) { return parseUUID(s, t) }
+	case "raw":
+	default:
+		fmt.Fprintln(stderr, "Bad input representation:", *from)
+		return 2
+	}
+
+	w := bufio.NewWriter(stdout)
+	defer w.Flush()
+
+	if *to == "csv" {
+		printCSVHeader(w)
+	}
+
+	failed := false
+	err := readInputs(fset.Args(), stdin, func(r io.Reader) {
+		if parse == nil {
+			failed = convertRaw(w, r, stderr, print) || failed
+			return
+		}
+		it := lineIter{r: bufio.NewReader(r), errw: stderr, parse: parse}
+		for it.Next() {
+			print(w, it.KSUID)
+		}
+		failed = it.failed || failed
+	})
+
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+// convertRaw prints the KSUIDs read from r as a sequence of 20 bytes records.
+func convertRaw(w io.Writer, r io.Reader, errw io.Writer, print func(io.Writer, ksuid.KSUID)) (failed bool) {
+	in := bufio.NewReader(r)
+
+	for n := 0; ; n++ {
+		var id ksuid.KSUID
+
+		switch _, err := io.ReadFull(in, id[:]); err {
+		case nil:
+			print(w, id)
+		case io.EOF:
+			return false
+		case io.ErrUnexpectedEOF:
+			fmt.Fprintf(errw, "Error when reading record %d: truncated KSUID\n", n+1)
+			return true
+		default:
+			fmt.Fprintf(errw, "Error when reading record %d: %s\n", n+1, err)
+			return true
+		}
+	}
+}
+
+// outputs are the representations supported by the -to flag of convert, in
+// addition to the formats of the -f flag.
+var outputs = map[string]func(io.Writer, ksuid.KSUID){
+	"base62": printString,
+	"hex":    printHex,
+	"uuid":   printUUID,
+	"raw":    printRaw,
+}
+
+func printHex(w io.Writer, id ksuid.KSUID) {
+	fmt.Fprintln(w, strings.ToUpper(hex.EncodeToString(id.Bytes())))
+}
+
+func printUUID(w io.Writer, id ksuid.KSUID) {
+	fmt.Fprintln(w, formatUUID(id.Payload()))
+}
+
+func formatUUID(b []byte) string {
+	s := hex.EncodeToString(b)
+	return s[:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:]
+}
+
+func parseHex(s string) (ksuid.KSUID, error) {
+	if len(s) != 2*len(ksuid.Nil) {
+		return ksuid.Nil, fmt.Errorf("hexadecimal KSUIDs are %d characters", 2*len(ksuid.Nil))
+	}
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return ksuid.Nil, err
+	}
+	return ksuid.FromBytes(b)
+}
+
+// parseUUID parses s as a UUID, with or without hyphens, and returns a KSUID
+// with the UUID as payload. The timestamp is taken from version 1 and version
+// 7 UUIDs, and is t for other versions and variants.
+func parseUUID(s string, t time.Time) (ksuid.KSUID, error) {
+	b, err := hex.DecodeString(strings.Replace(s, "-", "", -1))
+	if err != nil || len(b) != 16 {
+		return ksuid.Nil, errors.New("UUIDs are 32 hexadecimal digits, optionally separated by hyphens")
+	}
+
+	// Only UUIDs of the RFC 4122 variant have a version number.
+	version := 0
+	if b[8]&0xC0 == 0x80 {
+		version = int(b[6] >> 4)
+	}
+
+	switch version {
+	case 1:
+		// 100ns intervals since 1582-10-15, split in three fields.
+		ts := int64(b[6]&0x0F)<<56 | int64(b[7])<<48 | int64(b[4])<<40 | int64(b[5])<<32 | int64(binary.BigEndian.Uint32(b[:4]))
+		ts -= uuidEpochOffset
+		t = time.Unix(ts/1e7, (ts%1e7)*100)
+	case 7:
+		// Milliseconds since the Unix epoch in the first 48 bits.
+		ms := int64(binary.BigEndian.Uint64(append([]byte{0, 0}, b[:6]...)))
+		t = time.Unix(ms/1e3, (ms%1e3)*1e6)
+	}
+
+	if t.Before(minTime) || t.After(maxTime) {
+		return ksuid.Nil, fmt.Errorf("the time of the UUID (%s) is not within the range of KSUID timestamps", t.UTC().Format(time.RFC3339))
+	}
+
+	return ksuid.FromParts(t, b)
+}
+
+// The number of 100ns intervals between the UUID epoch (1582-10-15) and the
+// Unix epoch.
+const uuidEpochOffset = 0x01B21DD213814000
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/segmentio/ksuid"
+)
+
+func TestConvert(t *testing.T) {
+	ids := []ksuid.KSUID{ksuid.Nil, ksuid.Max}
+	for i := 0; i < 10; i++ {
+		ids = append(ids, ksuid.New())
+	}
+
+	base62 := &bytes.Buffer{}
+	for _, id := range ids {
+		base62.WriteString(id.String() + "\n")
+	}
+
+	for _, repr := range []string{"base62", "hex", "raw"} {
+		t.Run(repr, func(t *testing.T) {
+			encoded := testConvert(t, base62.String(), "-from", "base62", "-to", repr)
+			decoded := testConvert(t, encoded, "-from", repr, "-to", "base62")
+
+			if decoded != base62.String() {
+				t.Errorf("the round trip through %s changed the KSUIDs:\n%s", repr, decoded)
+			}
+		})
+	}
+
+	// UUIDs only hold the payload of KSUIDs, the round trip can only restore
+	// the UUIDs.
+	t.Run("uuid", func(t *testing.T) {
+		uuids := "3d813cbb-47fb-42ba-91df-831e1593ac29\n0190163d-8694-739b-aea5-966c26f8ad91\nc232ab00-9414-11ec-b3c8-9f6bdeced846\n"
+
+		encoded := testConvert(t, uuids, "-from", "uuid", "-to", "base62")
+		decoded := testConvert(t, encoded, "-from", "base62", "-to", "uuid")
+
+		if decoded != uuids {
+			t.Errorf("the round trip through base62 changed the UUIDs:\n%s", decoded)
+		}
+
+		encoded = testConvert(t, base62.String(), "-from", "base62", "-to", "uuid")
+		for i, line := range strings.Split(strings.TrimSpace(encoded), "\n") {
+			if uuid := formatUUID(ids[i].Payload()); line != uuid {
+				t.Errorf("bad UUID for %s: expected %s but got %s", ids[i], uuid, line)
+			}
+		}
+	})
+}
+
+func TestConvertUUID(t *testing.T) {
+	tests := []struct {
+		scenario string
+		uuid     string
+		time     time.Time
+	}{
+		{
+			scenario: "version 4 UUIDs use the -time flag",
+			uuid:     "3d813cbb-47fb-42ba-91df-831e1593ac29",
+			time:     time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			scenario: "version 7 UUIDs embed the time",
+			uuid:     "0190163d-8694-739b-aea5-966c26f8ad91",
+			time:     time.Date(2024, 6, 14, 10, 14, 9, 0, time.UTC),
+		},
+		{
+			scenario: "version 1 UUIDs embed the time",
+			uuid:     "c232ab00-9414-11ec-b3c8-9f6bdeced846",
+			time:     time.Date(2022, 2, 22, 19, 22, 22, 0, time.UTC),
+		},
+		{
+			scenario: "hyphens are optional",
+			uuid:     "3d813cbb47fb42ba91df831e1593ac29",
+			time:     time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.scenario, func(t *testing.T) {
+			out := testConvert(t, test.uuid+"\n", "-from", "uuid", "-to", "base62", "-time", "2024-01-01T00:00:00Z")
+
+			id, err := ksuid.Parse(strings.TrimSpace(out))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !id.Time().Equal(test.time) {
+				t.Errorf("bad time: expected %s but got %s", test.time, id.Time().UTC())
+			}
+			if s := formatUUID(id.Payload()); s != strings.ToLower(testCanonicalUUID(test.uuid)) {
+				t.Errorf("bad payload: expected %s but got %s", test.uuid, s)
+			}
+		})
+	}
+}
+
+func TestConvertErrors(t *testing.T) {
+	id := ksuid.New()
+
+	tests := []struct {
+		scenario string
+		args     []string
+		input    string
+		output   string
+		code     int
+	}{
+		{
+			scenario: "bad lines are skipped",
+			args:     []string{"-from", "hex", "-to", "base62"},
+			input:    "nope\n" + strings.ToUpper(id.String()) + "\n" + testHex(id) + "\n",
+			output:   id.String() + "\n",
+			code:     1,
+		},
+		{
+			scenario: "truncated raw records are reported",
+			args:     []string{"-from", "raw", "-to", "base62"},
+			input:    string(id[:]) + string(id[:10]),
+			output:   id.String() + "\n",
+			code:     1,
+		},
+		{
+			scenario: "UUIDs with a time out of range are rejected",
+			args:     []string{"-from", "uuid"},
+			input:    "00000000-0000-1000-8000-000000000000\n",
+			code:     1,
+		},
+		{
+			scenario: "unknown input representation",
+			args:     []string{"-from", "base64"},
+			code:     2,
+		},
+		{
+			scenario: "unknown output representation",
+			args:     []string{"-to", "base64"},
+			code:     2,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.scenario, func(t *testing.T) {
+			stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+
+			if code := convert(test.args, strings.NewReader(test.input), stdout, stderr); code != test.code {
+				t.Errorf("bad exit code: expected %d but got %d", test.code, code)
+			}
+			if s := stdout.String(); s != test.output {
+				t.Errorf("bad output:\n%s", s)
+			}
+			if stderr.Len() == 0 {
+				t.Error("no error was reported")
+			}
+		})
+	}
+}
+
+func testConvert(t *testing.T, input string, args ...string) string {
+	t.Helper()
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+
+	if code := convert(args, strings.NewReader(input), stdout, stderr); code != 0 {
+		t.Fatalf("convert %s exited with code %d: %s", strings.Join(args, " "), code, stderr)
+	}
+
+	return stdout.String()
+}
+
+func testHex(id ksuid.KSUID) string {
+	var b bytes.Buffer
+	printHex(&b, id)
+	return strings.TrimSpace(b.String())
+}
+
+func testCanonicalUUID(s string) string {
+	if len(s) == 32 {
+		return s[:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:]
+	}
+	return s
+}
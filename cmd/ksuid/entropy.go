@@ -0,0 +1,196 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/segmentio/ksuid"
+)
+
+const checkEntropyHelp = `Checks the randomness of the payloads of generated KSUIDs. It runs basic
+statistical tests which catch a broken source of random bytes, like a counter or
+a reader returning constant bytes set with SetRand, and the exit code is 1 if
+any of them fails:
+
+  bits        every bit of the payload is set in half of the KSUIDs
+  duplicates  no two KSUIDs have the same payload
+  monotonic   every byte of the payload is greater than the same byte of the
+              previous KSUID in half of the KSUIDs
+
+Passing the tests does not mean that the KSUIDs are cryptographically secure.`
+
+func checkEntropy(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	var src randSource
+
+	fset := newFlagSet("check-entropy", stderr)
+	n := fset.Float64("n", 1e6, "The number of KSUIDs to generate, at least 1000.")
+	src.register(fset)
+
+	if code, ok := parseFlags(fset, args); !ok {
+		return code
+	}
+
+	if fset.NArg() != 0 || *n < 1000 || *n > math.MaxInt32 || *n != math.Trunc(*n) {
+		fset.Usage()
+		return 2
+	}
+
+	if !src.set() {
+		fmt.Fprintln(stderr, "Bad source of random bytes:", src.name)
+		return 2
+	}
+	defer ksuid.SetRand(nil)
+
+	ids := make([]ksuid.KSUID, int(*n))
+
+	for i := range ids {
+		id, err := ksuid.NewRandom()
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		ids[i] = id
+	}
+
+	failed := false
+
+	for _, r := range entropyChecks(ids) {
+		status := "PASS"
+		if !r.ok {
+			status, failed = "FAIL", true
+		}
+		fmt.Fprintf(stdout, "%s  %-10s  %s\n", status, r.name, r.detail)
+	}
+
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+// entropyMaxScore is the highest deviation from the expected counts allowed
+// by the tests, in standard deviations. A test of truly random payloads fails
+// with a probability lower than one in a million.
+const entropyMaxScore = 6.0
+
+type entropyResult struct {
+	name   string
+	ok     bool
+	detail string
+}
+
+// entropyChecks runs the tests of the check-entropy command on the payloads of
+// ids, which must be in the order they were generated in.
+func entropyChecks(ids []ksuid.KSUID) []entropyResult {
+	return []entropyResult{
+		checkBits(ids),
+		checkDuplicates(ids),
+		checkMonotonic(ids),
+	}
+}
+
+func checkBits(ids []ksuid.KSUID) entropyResult {
+	var ones [128]int
+
+	for _, id := range ids {
+		p := id.Payload()
+		for i := range ones {
+			ones[i] += int(p[i/8]>>(7-uint(i%8))) & 1
+		}
+	}
+
+	n := float64(len(ids))
+	worst, score := 0, 0.0
+
+	for i, count := range ones {
+		// Binomial distribution with p = 1/2.
+		if z := math.Abs(float64(count)-n/2) / (math.Sqrt(n) / 2); z > score {
+			worst, score = i, z
+		}
+	}
+
+	return entropyResult{
+		name:   "bits",
+		ok:     score <= entropyMaxScore,
+		detail: fmt.Sprintf("bit %d is set in %.4f of the KSUIDs (%.2f standard deviations)", worst, float64(ones[worst])/n, score),
+	}
+}
+
+func checkDuplicates(ids []ksuid.KSUID) entropyResult {
+	// Sorting KSUIDs with the timestamps cleared sorts the payloads.
+	payloads := make([]ksuid.KSUID, len(ids))
+	for i, id := range ids {
+		copy(payloads[i][4:], id.Payload())
+	}
+	ksuid.Sort(payloads)
+
+	dups := 0
+	for i := 1; i < len(payloads); i++ {
+		if payloads[i] == payloads[i-1] {
+			dups++
+		}
+	}
+
+	return entropyResult{
+		name:   "duplicates",
+		ok:     dups == 0,
+		detail: fmt.Sprintf("%d duplicate payloads", dups),
+	}
+}
+
+func checkMonotonic(ids []ksuid.KSUID) entropyResult {
+	var greater [16]int
+
+	for i := 1; i < len(ids); i++ {
+		p, q := ids[i-1].Payload(), ids[i].Payload()
+		for j := range greater {
+			if q[j] > p[j] {
+				greater[j]++
+			}
+		}
+	}
+
+	// A random byte is greater than another one with a probability of
+	// (1 - 1/256) / 2.
+	n := float64(len(ids) - 1)
+	p := 255.0 / 512.0
+	worst, score := 0, 0.0
+
+	for i, count := range greater {
+		if z := math.Abs(float64(count)-n*p) / math.Sqrt(n*p*(1-p)); z > score {
+			worst, score = i, z
+		}
+	}
+
+	return entropyResult{
+		name:   "monotonic",
+		ok:     score <= entropyMaxScore,
+		detail: fmt.Sprintf("byte %d is greater than in the previous KSUID in %.4f of the KSUIDs (%.2f standard deviations)", worst, float64(greater[worst])/n, score),
+	}
+}
+
+// randSource is the flag selecting the source of random bytes of generated
+// KSUIDs.
+type randSource struct {
+	name string
+}
+
+func (src *randSource) register(fset *flag.FlagSet) {
+	fset.StringVar(&src.name, "rand", "crypto", "The source of random bytes, crypto for crypto/rand or fast for FastRander.")
+}
+
+// set configures the source of random bytes of the ksuid package, it must be
+// reset with SetRand(nil) when done.
+func (src *randSource) set() bool {
+	switch src.name {
+	case "crypto":
+		ksuid.SetRand(nil)
+	case "fast":
+		ksuid.SetRand(ksuid.FastRander)
+	default:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/segmentio/ksuid"
+)
+
+func TestEntropyChecks(t *testing.T) {
+	const n = 10000
+
+	tests := []struct {
+		scenario string
+		payload  func(ids []ksuid.KSUID, i int)
+		failed   []string
+	}{
+		{
+			scenario: "random payloads pass all tests",
+			payload: func(ids []ksuid.KSUID, i int) {
+				copy(ids[i][4:], ksuid.New().Payload())
+			},
+		},
+		{
+			scenario: "constant payloads fail all tests",
+			payload: func(ids []ksuid.KSUID, i int) {
+				for j := 4; j != len(ids[i]); j++ {
+					ids[i][j] = 0xA5
+				}
+			},
+			failed: []string{"bits", "duplicates", "monotonic"},
+		},
+		{
+			scenario: "counters fail the bits and monotonic tests",
+			payload: func(ids []ksuid.KSUID, i int) {
+				ksuid.FastRander.Read(ids[i][4:])
+				binary.BigEndian.PutUint32(ids[i][16:], uint32(i))
+			},
+			failed: []string{"bits", "monotonic"},
+		},
+		{
+			scenario: "repeated payloads fail the duplicates test",
+			payload: func(ids []ksuid.KSUID, i int) {
+				if i == n-1 {
+					ids[i] = ids[0]
+				} else {
+					copy(ids[i][4:], ksuid.New().Payload())
+				}
+			},
+			failed: []string{"duplicates"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.scenario, func(t *testing.T) {
+			ids := make([]ksuid.KSUID, n)
+			for i := range ids {
+				test.payload(ids, i)
+			}
+
+			failed := []string{}
+			for _, r := range entropyChecks(ids) {
+				if !r.ok {
+					failed = append(failed, r.name)
+				}
+			}
+
+			if len(failed) != len(test.failed) {
+				t.Fatalf("bad failed tests: expected %v but got %v", test.failed, failed)
+			}
+			for i := range failed {
+				if failed[i] != test.failed[i] {
+					t.Fatalf("bad failed tests: expected %v but got %v", test.failed, failed)
+				}
+			}
+		})
+	}
+}
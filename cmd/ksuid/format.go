@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/segmentio/ksuid"
+)
+
+const formatUsage = "One of string, inspect, time, timestamp, payload, raw, json, csv, or template."
+
+// formatOptions are the flags controlling how KSUIDs are printed.
+type formatOptions struct {
+	format   string
+	template string
+	verbose  bool
+	err      error // the first error of the template
+}
+
+func (opts *formatOptions) register(fset *flag.FlagSet) {
+	opts.registerDefault(fset, "string")
+}
+
+func (opts *formatOptions) registerDefault(fset *flag.FlagSet, format string) {
+	fset.StringVar(&opts.format, "f", format, formatUsage)
+	fset.StringVar(&opts.template, "t", "", templateUsage)
+	fset.BoolVar(&opts.verbose, "v", false, "Turn on verbose mode.")
+}
+
+// printer returns the function printing KSUIDs in the format selected by the
+// options. The csv header is written to w when it is the selected format.
+func (opts *formatOptions) printer(w io.Writer) (func(io.Writer, ksuid.KSUID), error) {
+	var print func(io.Writer, ksuid.KSUID)
+
+	if opts.format == "template" {
+		var err error
+		if print, err = templateFunc(opts.template, &opts.err); err != nil {
+			return nil, fmt.Errorf("Bad template: %s", err)
+		}
+	} else if print = printers[opts.format]; print == nil {
+		return nil, fmt.Errorf("Bad formatting function: %s", opts.format)
+	}
+
+	// The json and csv formats already include the KSUID in their records,
+	// prefixing them would only make the output harder to parse.
+	if opts.verbose && opts.format != "json" && opts.format != "csv" {
+		print = withPrefix(print)
+	}
+
+	if opts.format == "csv" {
+		printCSVHeader(w)
+	}
+
+	return print, nil
+}
+
+// failed reports the error which stopped the printing of KSUIDs to errw, and
+// returns true if there was one.
+func (opts *formatOptions) failed(errw io.Writer) bool {
+	if opts.err == nil {
+		return false
+	}
+	fmt.Fprintln(errw, "Error when executing the template:", opts.err)
+	return true
+}
+
+// printStream prints the KSUIDs read from r, one per line. Lines that cannot be
+// parsed are reported to errw and skipped, printStream returns true if there
+// were any.
+//
+// The output is flushed whenever the input has no more buffered data, so KSUIDs
+// typed on a terminal or written slowly to a pipe are printed right away.
+func printStream(w *bufio.Writer, r io.Reader, errw io.Writer, print func(io.Writer, ksuid.KSUID)) (failed bool) {
+	in := bufio.NewReader(r)
+
+	return scanKSUIDs(in, errw, func(id ksuid.KSUID) {
+		print(w, id)
+		if in.Buffered() == 0 {
+			w.Flush()
+		}
+	})
+}
+
+// scanKSUIDs calls fn with the KSUIDs read from r, one per line. Empty lines
+// are ignored, lines that cannot be parsed are reported to errw and skipped,
+// scanKSUIDs returns true if there were any.
+func scanKSUIDs(r *bufio.Reader, errw io.Writer, fn func(ksuid.KSUID)) (failed bool) {
+	it := lineIter{r: r, errw: errw}
+	for it.Next() {
+		fn(it.KSUID)
+	}
+	return it.failed
+}
+
+// printers are the functions used to print KSUIDs in the formats supported by
+// the -f flag.
+var printers = map[string]func(io.Writer, ksuid.KSUID){
+	"string":    printString,
+	"inspect":   printInspect,
+	"time":      printTime,
+	"timestamp": printTimestamp,
+	"payload":   printPayload,
+	"raw":       printRaw,
+	"json":      printJSON,
+	"csv":       printCSV,
+}
+
+func withPrefix(print func(io.Writer, ksuid.KSUID)) func(io.Writer, ksuid.KSUID) {
+	return func(w io.Writer, id ksuid.KSUID) {
+		fmt.Fprintf(w, "%s: ", id)
+		print(w, id)
+	}
+}
+
+func printString(w io.Writer, id ksuid.KSUID) {
+	fmt.Fprintln(w, id.String())
+}
+
+func printInspect(w io.Writer, id ksuid.KSUID) {
+	const inspectFormat = `
+REPRESENTATION:
+
+  String: %v
+     Raw: %v
+
+COMPONENTS:
+
+       Time: %v
+  Timestamp: %v
+    Payload: %v
+
+`
+	fmt.Fprintf(w, inspectFormat,
+		id.String(),
+		strings.ToUpper(hex.EncodeToString(id.Bytes())),
+		id.Time(),
+		id.Timestamp(),
+		strings.ToUpper(hex.EncodeToString(id.Payload())),
+	)
+}
+
+func printTime(w io.Writer, id ksuid.KSUID) {
+	fmt.Fprintln(w, id.Time())
+}
+
+func printTimestamp(w io.Writer, id ksuid.KSUID) {
+	fmt.Fprintln(w, id.Timestamp())
+}
+
+func printPayload(w io.Writer, id ksuid.KSUID) {
+	w.Write(id.Payload())
+}
+
+func printRaw(w io.Writer, id ksuid.KSUID) {
+	w.Write(id.Bytes())
+}
+
+type record struct {
+	String    string `json:"string"`
+	Hex       string `json:"hex"`
+	Time      string `json:"time"`
+	Timestamp uint32 `json:"timestamp"`
+	Payload   string `json:"payload"`
+}
+
+func makeRecord(id ksuid.KSUID) record {
+	return record{
+		String:    id.String(),
+		Hex:       strings.ToUpper(hex.EncodeToString(id.Bytes())),
+		Time:      id.Time().UTC().Format(time.RFC3339),
+		Timestamp: id.Timestamp(),
+		Payload:   strings.ToUpper(hex.EncodeToString(id.Payload())),
+	}
+}
+
+func printJSON(w io.Writer, id ksuid.KSUID) {
+	json.NewEncoder(w).Encode(makeRecord(id))
+}
+
+func printCSVHeader(w io.Writer) {
+	c := csv.NewWriter(w)
+	c.Write([]string{"string", "hex", "time", "timestamp", "payload"})
+	c.Flush()
+}
+
+func printCSV(w io.Writer, id ksuid.KSUID) {
+	r := makeRecord(id)
+	c := csv.NewWriter(w)
+	c.Write([]string{r.String, r.Hex, r.Time, strconv.FormatUint(uint64(r.Timestamp), 10), r.Payload})
+	c.Flush()
+}
+
+const templateUsage = `The Go template used to format the output with -f template. The fields are
+String, Raw, Hex, Base32, Time, Timestamp, UnixMilli, Payload, Sequence, Next,
+Prev and Index, the functions are hex, base32, upper and lower.`
+
+// templateData is the value that templates are executed with.
+type templateData struct {
+	ksuid.KSUID // String, Time, Timestamp, Next, Prev...
+
+	Raw       string // uppercase hexadecimal
+	Hex       string // lowercase hexadecimal
+	Base32    string
+	UnixMilli int64
+	Payload   string // uppercase hexadecimal
+	Sequence  uint16 // the last two bytes, where Sequence stores its counter
+	Index     int    // the position of the KSUID in the output, from zero
+}
+
+func makeTemplateData(id ksuid.KSUID, index int) templateData {
+	return templateData{
+		KSUID:     id,
+		Raw:       strings.ToUpper(hex.EncodeToString(id.Bytes())),
+		Hex:       hex.EncodeToString(id.Bytes()),
+		Base32:    base32.StdEncoding.EncodeToString(id.Bytes()),
+		UnixMilli: int64(id.Time().Unix()) * 1000,
+		Payload:   strings.ToUpper(hex.EncodeToString(id.Payload())),
+		Sequence:  binary.BigEndian.Uint16(id[len(id)-2:]),
+		Index:     index,
+	}
+}
+
+var templateFuncs = template.FuncMap{
+	"hex":    func(id ksuid.KSUID) string { return hex.EncodeToString(id.Bytes()) },
+	"base32": func(id ksuid.KSUID) string { return base32.StdEncoding.EncodeToString(id.Bytes()) },
+	"upper":  strings.ToUpper,
+	"lower":  strings.ToLower,
+}
+
+// templateFunc returns a function printing KSUIDs with the Go template text.
+// The template is only executed until it fails, the error is then stored in
+// *errp and nothing else is printed.
+func templateFunc(text string, errp *error) (func(io.Writer, ksuid.KSUID), error) {
+	t, err := template.New("").Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &bytes.Buffer{}
+	index := 0
+
+	return func(w io.Writer, id ksuid.KSUID) {
+		if *errp != nil {
+			return
+		}
+
+		b.Reset()
+		if err := t.Execute(b, makeTemplateData(id, index)); err != nil {
+			*errp = err
+			return
+		}
+
+		b.WriteByte('\n')
+		w.Write(b.Bytes())
+		index++
+	}, nil
+}
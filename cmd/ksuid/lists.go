@@ -0,0 +1,286 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/segmentio/ksuid"
+)
+
+const sortHelp = `Reads KSUIDs from the files, or stdin, and prints them in order. The exit code
+is 1 if some lines could not be parsed.`
+
+// sortCommand reads KSUIDs from files or stdin and prints them in order.
+func sortCommand(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fset := newFlagSet("sort", stderr)
+	unique := fset.Bool("u", false, "Print each KSUID only once.")
+
+	if code, ok := parseFlags(fset, args); !ok {
+		return code
+	}
+
+	ids, failed, err := readKSUIDs(fset.Args(), stdin, stderr)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	ksuid.ParallelSort(ids, 0)
+
+	if *unique {
+		ids = ksuid.Dedup(ids)
+	}
+
+	w := bufio.NewWriter(stdout)
+	for _, id := range ids {
+		fmt.Fprintln(w, id)
+	}
+	w.Flush()
+
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+const mergeHelp = `Reads KSUIDs from the sorted files, or stdin, and prints them in order. Lines
+which are out of order are reported and skipped. The exit code is 1 if some
+lines could not be parsed or were out of order.`
+
+// merge reads KSUIDs from sorted files and prints them in order, without
+// loading them in memory.
+func merge(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fset := newFlagSet("merge", stderr)
+	unique := fset.Bool("u", false, "Print each KSUID only once.")
+
+	if code, ok := parseFlags(fset, args); !ok {
+		return code
+	}
+
+	files := fset.Args()
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+
+	lines := make([]lineIter, len(files))
+	iters := make([]ksuid.Iterator, len(files))
+
+	for i, file := range files {
+		r, err := openInput(file, stdin)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		defer r.Close()
+		lines[i] = lineIter{r: bufio.NewReader(r), name: file, errw: stderr, sorted: true}
+		iters[i] = &lines[i]
+	}
+
+	w := bufio.NewWriter(stdout)
+	n := 0
+	prev := ksuid.Nil
+
+	for it := ksuid.MergeIters(iters...); it.Next(); {
+		if *unique && n != 0 && it.KSUID == prev {
+			continue
+		}
+		fmt.Fprintln(w, it.KSUID)
+		prev = it.KSUID
+		n++
+	}
+
+	w.Flush()
+
+	for _, it := range lines {
+		if it.failed {
+			return 1
+		}
+	}
+	return 0
+}
+
+const diffHelp = `Compares two lists of KSUIDs. The KSUIDs which are only in FILE1 are printed
+prefixed with <, and those only in FILE2 prefixed with >, in order. Either file
+may be - to read stdin.
+
+The files are streamed and must be sorted, like the output of the sort command.
+Lines which cannot be parsed or are out of order are reported and skipped.
+
+The exit code is 0 if the files have the same KSUIDs, 1 if they differ, and 2
+if an error occurred.`
+
+// diff prints the KSUIDs which are only in one of two sorted files, prefixed
+// with < for the first file and > for the second.
+func diff(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fset := newFlagSet("diff", stderr)
+
+	if code, ok := parseFlags(fset, args); !ok {
+		return code
+	}
+
+	if fset.NArg() != 2 {
+		fset.Usage()
+		return 2
+	}
+
+	if fset.Arg(0) == "-" && fset.Arg(1) == "-" {
+		fmt.Fprintln(stderr, "Only one of the files can be read from stdin.")
+		return 2
+	}
+
+	var lines [2]lineIter
+
+	for i, file := range fset.Args() {
+		r, err := openInput(file, stdin)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 2
+		}
+		defer r.Close()
+		lines[i] = lineIter{r: bufio.NewReader(r), name: file, errw: stderr, sorted: true}
+	}
+
+	w := bufio.NewWriter(stdout)
+	defer w.Flush()
+
+	a, b := &lines[0], &lines[1]
+	okA, okB := nextUnique(a), nextUnique(b)
+	differ := false
+
+	for okA || okB {
+		switch {
+		case !okB || (okA && ksuid.Compare(a.KSUID, b.KSUID) < 0):
+			fmt.Fprintln(w, "<", a.KSUID)
+			okA, differ = nextUnique(a), true
+		case !okA || ksuid.Compare(b.KSUID, a.KSUID) < 0:
+			fmt.Fprintln(w, ">", b.KSUID)
+			okB, differ = nextUnique(b), true
+		default:
+			okA, okB = nextUnique(a), nextUnique(b)
+		}
+	}
+
+	switch {
+	case a.failed || b.failed:
+		return 2
+	case differ:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// nextUnique moves it to the next KSUID which differs from the current one.
+func nextUnique(it *lineIter) bool {
+	prev, started := it.KSUID, it.count != 0
+
+	for it.Next() {
+		if !started || it.KSUID != prev {
+			return true
+		}
+	}
+
+	return false
+}
+
+// readKSUIDs returns the KSUIDs read from the files, or stdin if there are
+// none. Lines that cannot be parsed are reported to errw and skipped, the
+// returned boolean is true if there were any.
+func readKSUIDs(files []string, stdin io.Reader, errw io.Writer) (ids []ksuid.KSUID, failed bool, err error) {
+	err = readInputs(files, stdin, func(r io.Reader) {
+		failed = scanKSUIDs(bufio.NewReader(r), errw, func(id ksuid.KSUID) {
+			ids = append(ids, id)
+		}) || failed
+	})
+	return
+}
+
+// openInput opens the file with the given name, or returns stdin for -.
+func openInput(name string, stdin io.Reader) (io.ReadCloser, error) {
+	if name == "-" {
+		return ioutil.NopCloser(stdin), nil
+	}
+	return os.Open(name)
+}
+
+// lineIter is a ksuid.Iterator which produces the KSUIDs read from r, one per
+// line. Empty lines are ignored, lines that cannot be parsed, or are out of
+// order when sorted is true, are reported to errw and skipped.
+type lineIter struct {
+	KSUID ksuid.KSUID
+
+	r      *bufio.Reader
+	name   string
+	errw   io.Writer
+	parse  func(string) (ksuid.KSUID, error) // parseKSUID if nil
+	sorted bool
+	lineno int
+	count  int
+	failed bool
+	err    error
+}
+
+func (it *lineIter) Next() bool {
+	for it.err == nil {
+		var line string
+		line, it.err = it.r.ReadString('\n')
+		it.lineno++
+
+		if it.err != nil && it.err != io.EOF {
+			it.report("Error when reading line %d: %s", it.lineno, it.err)
+		}
+
+		s := strings.TrimSpace(line)
+		if s == "" {
+			continue
+		}
+
+		parse := it.parse
+		if parse == nil {
+			parse = parseKSUID
+		}
+
+		id, err := parse(s)
+		switch {
+		case err != nil:
+			it.report("Error when parsing %q on line %d: %s", s, it.lineno, err)
+		case it.sorted && it.count != 0 && ksuid.Compare(id, it.KSUID) < 0:
+			it.report("Error: %s on line %d is lower than the KSUID before it", s, it.lineno)
+		default:
+			it.KSUID = id
+			it.count++
+			return true
+		}
+	}
+	return false
+}
+
+func (it *lineIter) ID() ksuid.KSUID {
+	return it.KSUID
+}
+
+func (it *lineIter) report(msg string, args ...interface{}) {
+	if it.name != "" && it.name != "-" {
+		msg = it.name + ": " + msg
+	}
+	fmt.Fprintf(it.errw, msg+"\n", args...)
+	it.failed = true
+}
+
+// parseKSUID parses s as a KSUID in its base62 string representation, or as 40
+// hexadecimal digits.
+func parseKSUID(s string) (ksuid.KSUID, error) {
+	if len(s) == 2*len(ksuid.Nil) {
+		b, err := hex.DecodeString(s)
+		if err != nil {
+			return ksuid.Nil, err
+		}
+		return ksuid.FromBytes(b)
+	}
+	return ksuid.Parse(s)
+}
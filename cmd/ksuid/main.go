@@ -1,142 +1,186 @@
 package main
 
 import (
-	"bytes"
-	"encoding/hex"
 	"flag"
 	"fmt"
 	"io"
 	"os"
 	"strings"
-	"text/template"
-	"time"
-
-	"github.com/segmentio/ksuid"
 )
 
-var (
-	count   int
-	format  string
-	tpltxt  string
-	verbose bool
-)
+// command is a subcommand of the ksuid program, selected by its first
+// argument.
+type command struct {
+	name   string
+	args   string // synopsis of the arguments, after the flags
+	help   string
+	hidden bool // aliases kept for compatibility are not listed in the help
+	run    func(args []string, stdin io.Reader, stdout, stderr io.Writer) int
+}
+
+var commands []command
 
 func init() {
-	flag.IntVar(&count, "n", 1, "Number of KSUIDs to generate when called with no other arguments.")
-	flag.StringVar(&format, "f", "string", "One of string, inspect, time, timestamp, payload, raw, or template.")
-	flag.StringVar(&tpltxt, "t", "", "The Go template used to format the output.")
-	flag.BoolVar(&verbose, "v", false, "Turn on verbose mode.")
+	// The table is populated in init because the help command refers to it.
+	commands = []command{
+		{name: "new", help: newHelp, run: newCommand},
+		{name: "inspect", args: "[- | KSUID...]", help: inspectHelp, run: inspect},
+		{name: "parse", args: "[- | KSUID...]", help: parseHelp, run: parse},
+		{name: "convert", args: "[FILE...]", help: convertHelp, run: convert},
+		{name: "set", args: "compress|decompress|stats [FILE...]", help: setHelp, run: set},
+		{name: "range", args: "LOW HIGH", help: rangeHelp, run: rangeCommand},
+		{name: "sort", args: "[FILE...]", help: sortHelp, run: sortCommand},
+		{name: "merge", args: "[FILE...]", help: mergeHelp, run: merge},
+		{name: "diff", args: "FILE1 FILE2", help: diffHelp, run: diff},
+		{name: "bench", help: benchHelp, run: bench},
+		{name: "serve", help: serveHelp, run: serve},
+		{name: "check-entropy", help: checkEntropyHelp, run: checkEntropy},
+		{name: "help", args: "[COMMAND]", help: "Prints the help of the ksuid program, or of one of its commands.", run: help},
+		{name: "compress", args: "[FILE...]", help: compressHelp, run: compress, hidden: true},
+		{name: "decompress", args: "[FILE]", help: decompressHelp, run: decompress, hidden: true},
+		{name: "set-stats", args: "[FILE]", help: setStatsHelp, run: setStats, hidden: true},
+	}
 }
 
 func main() {
-	flag.Parse()
-	args := flag.Args()
-
-	var print func(ksuid.KSUID)
-	switch format {
-	case "string":
-		print = printString
-	case "inspect":
-		print = printInspect
-	case "time":
-		print = printTime
-	case "timestamp":
-		print = printTimestamp
-	case "payload":
-		print = printPayload
-	case "raw":
-		print = printRaw
-	case "template":
-		print = printTemplate
-	default:
-		fmt.Println("Bad formatting function:", format)
-		os.Exit(1)
-	}
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
 
-	if len(args) == 0 {
-		for i := 0; i < count; i++ {
-			args = append(args, ksuid.New().String())
+// run executes the ksuid program with the given arguments and returns its exit
+// code.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) != 0 {
+		if cmd := findCommand(args[0]); cmd != nil {
+			return cmd.run(args[1:], stdin, stdout, stderr)
 		}
 	}
+	return legacy(args, stdin, stdout, stderr)
+}
 
-	var ids []ksuid.KSUID
-	for _, arg := range args {
-		id, err := ksuid.Parse(arg)
-		if err != nil {
-			fmt.Printf("Error when parsing %q: %s\n\n", arg, err)
-			flag.PrintDefaults()
-			os.Exit(1)
+func findCommand(name string) *command {
+	for i := range commands {
+		if commands[i].name == name {
+			return &commands[i]
 		}
-		ids = append(ids, id)
 	}
+	return nil
+}
 
-	for _, id := range ids {
-		if verbose {
-			fmt.Printf("%s: ", id)
+// newFlagSet returns the flag set of the command with the given name, which
+// reports errors and prints the help of the command to stderr.
+func newFlagSet(name string, stderr io.Writer) *flag.FlagSet {
+	fset := flag.NewFlagSet(name, flag.ContinueOnError)
+	fset.SetOutput(stderr)
+	fset.Usage = func() {
+		cmd := findCommand(name)
+		synopsis := cmd.name + " [flags]"
+		if cmd.args != "" {
+			synopsis += " " + cmd.args
 		}
-		print(id)
+		fmt.Fprintf(stderr, "Usage: ksuid %s\n\n%s\n", synopsis, cmd.help)
+		printFlags(fset)
 	}
+	return fset
 }
 
-func printString(id ksuid.KSUID) {
-	fmt.Println(id.String())
+// parseFlags parses the arguments of a command. When the command must stop,
+// which happens after printing its help or on invalid flags, parseFlags returns
+// false and the exit code of the program.
+func parseFlags(fset *flag.FlagSet, args []string) (int, bool) {
+	switch err := fset.Parse(args); err {
+	case nil:
+		return 0, true
+	case flag.ErrHelp:
+		return 0, false
+	default:
+		return 2, false
+	}
 }
 
-func printInspect(id ksuid.KSUID) {
-	const inspectFormat = `
-REPRESENTATION:
+func printFlags(fset *flag.FlagSet) {
+	n := 0
+	fset.VisitAll(func(*flag.Flag) { n++ })
 
-  String: %v
-     Raw: %v
+	if n != 0 {
+		fmt.Fprint(fset.Output(), "\nFlags:\n")
+		fset.PrintDefaults()
+	}
+}
 
-COMPONENTS:
+func help(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) != 0 {
+		cmd := findCommand(args[0])
+		if cmd == nil {
+			fmt.Fprintln(stderr, "Unknown command:", args[0])
+			return 2
+		}
+		// Commands print their help to stderr when called with -h, it goes to
+		// stdout here since it was explicitly requested.
+		return cmd.run([]string{"-h"}, stdin, stdout, stdout)
+	}
 
-       Time: %v
-  Timestamp: %v
-    Payload: %v
+	fmt.Fprint(stdout, "Usage: ksuid COMMAND [flags] [arguments]\n\nCommands:\n\n")
 
-`
-	fmt.Printf(inspectFormat,
-		id.String(),
-		strings.ToUpper(hex.EncodeToString(id.Bytes())),
-		id.Time(),
-		id.Timestamp(),
-		strings.ToUpper(hex.EncodeToString(id.Payload())),
-	)
-}
+	width := 0
+	for _, cmd := range commands {
+		if !cmd.hidden && len(cmd.name) > width {
+			width = len(cmd.name)
+		}
+	}
 
-func printTime(id ksuid.KSUID) {
-	fmt.Println(id.Time())
-}
+	for _, cmd := range commands {
+		if !cmd.hidden {
+			fmt.Fprintf(stdout, "  %-*s  %s\n", width, cmd.name, firstSentence(cmd.help))
+		}
+	}
 
-func printTimestamp(id ksuid.KSUID) {
-	fmt.Println(id.Timestamp())
+	fmt.Fprint(stdout, legacyHelp)
+	return 0
 }
 
-func printPayload(id ksuid.KSUID) {
-	os.Stdout.Write(id.Payload())
-}
+const legacyHelp = `
+Run 'ksuid help COMMAND' for the flags and arguments of a command.
+
+Without a command, ksuid accepts the flags of the new and parse commands. It
+generates KSUIDs when called with no arguments, like the new command, and prints
+the KSUIDs given as arguments otherwise, like the parse command.
+`
 
-func printRaw(id ksuid.KSUID) {
-	os.Stdout.Write(id.Bytes())
+func firstSentence(s string) string {
+	s = strings.Replace(s, "\n", " ", -1)
+	if i := strings.Index(s, ". "); i >= 0 {
+		return s[:i+1]
+	}
+	return strings.TrimSpace(s)
 }
 
-func printTemplate(id ksuid.KSUID) {
-	b := &bytes.Buffer{}
-	t := template.Must(template.New("").Parse(tpltxt))
-	t.Execute(b, struct {
-		String    string
-		Raw       string
-		Time      time.Time
-		Timestamp uint32
-		Payload   string
-	}{
-		String:    id.String(),
-		Raw:       strings.ToUpper(hex.EncodeToString(id.Bytes())),
-		Time:      id.Time(),
-		Timestamp: id.Timestamp(),
-		Payload:   strings.ToUpper(hex.EncodeToString(id.Payload())),
-	})
-	b.WriteByte('\n')
-	io.Copy(os.Stdout, b)
+// legacy runs the ksuid program for arguments that don't start with a command,
+// which is how the program worked before it had commands.
+func legacy(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	var gen generateOptions
+	var opts formatOptions
+
+	fset := flag.NewFlagSet("ksuid", flag.ContinueOnError)
+	fset.SetOutput(stderr)
+	fset.Usage = func() {
+		help(nil, stdin, stderr, stderr)
+		printFlags(fset)
+	}
+	gen.register(fset)
+	opts.register(fset)
+
+	if code, ok := parseFlags(fset, args); !ok {
+		return code
+	}
+
+	if fset.NArg() == 0 {
+		return generateKSUIDs(&gen, &opts, stdout, stderr)
+	}
+
+	if gen.used() {
+		fmt.Fprintln(stderr, "The -time, -from, -to, -min and -max flags cannot be used with KSUID arguments.")
+		return 2
+	}
+
+	return printKSUIDs(fset.Args(), &opts, stdin, stdout, stderr)
 }
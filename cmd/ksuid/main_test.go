@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "Update the golden files of the tests.")
+
+func init() {
+	// The inspect and time formats print times in the local time zone.
+	time.Local = time.UTC
+}
+
+func TestGolden(t *testing.T) {
+	const (
+		id1 = "0ujtsYcgvSTl8PAuAdqWYSMnLOv"
+		id2 = "0ujzPyRiIAffKhBux4PvQdDqMHY"
+		id3 = "0ujsswThIGTUYm2K8FjOOfXtY1K"
+	)
+
+	tests := []struct {
+		name  string
+		args  []string
+		stdin string
+		then  []string // arguments of a second command reading the output
+		code  int
+	}{
+		{name: "help", args: []string{"help"}},
+		{name: "help-range", args: []string{"help", "range"}},
+		{name: "help-convert", args: []string{"help", "convert"}},
+		{name: "help-unknown", args: []string{"help", "nope"}, code: 2},
+		{name: "new-min", args: []string{"new", "-min", "-time", "2024-01-01T00:00:00Z", "-f", "json"}},
+		{name: "new-max", args: []string{"new", "-max", "-time", "2024-01-01T00:00:00Z"}},
+		{name: "new-negative", args: []string{"new", "-n", "-1"}, code: 2},
+		{name: "legacy-negative", args: []string{"-n", "-1"}, code: 2},
+		{name: "new-args", args: []string{"new", id1}, code: 2},
+		{name: "inspect", args: []string{"inspect", id1}},
+		{name: "parse", args: []string{"parse", "-f", "json", id1, "0669F7EFB5A1CD34B5F99D1154FB6853345C9735"}},
+		{name: "parse-csv", args: []string{"parse", "-f", "csv", "-v", id1, id2}},
+		{name: "parse-stdin", args: []string{"parse", "-f", "time", "-v", "-"}, stdin: id1 + "\nnope\n" + id2 + "\n", code: 1},
+		{name: "parse-errors", args: []string{"parse", "nope", id2}, code: 1},
+		{name: "parse-format", args: []string{"parse", "-f", "nope", id1}, code: 2},
+		{name: "parse-template", args: []string{"parse", "-f", "template", "-t", "{{.Timestamp}} {{.Payload}}", id1, id2}},
+		{name: "parse-template-fields", args: []string{"parse", "-f", "template", "-t", "{{.Index}} {{.Hex}} {{.Base32}} {{.UnixMilli}} {{.Sequence}} {{.Next}} {{upper (hex .Prev)}} {{.Time.Format \"2006-01-02\"}}", id1, id2}},
+		{name: "parse-template-error", args: []string{"parse", "-f", "template", "-t", "{{.Nope}}", id1, id2}, code: 1},
+		{name: "parse-template-syntax", args: []string{"parse", "-f", "template", "-t", "{{.Nope", id1}, code: 2},
+		{name: "convert", args: []string{"convert", "-to", "uuid"}, stdin: id1 + "\n" + id2 + "\n"},
+		{name: "set-stats", args: []string{"set", "stats", "-base64"}, stdin: "S1NFVAEAAAAAAAAAAwZp9gVnrVNkVcGBPXiPV8pUZ5QSBmoCnHP8GqOyRGJG1uifzZCej+gABmn2BWetU2RVwYE9eI9XylRnlBJCAeq1oc00tfmdEVT7aFM0XJc1Qgqtc/wao7JEYkbW6J/NkJ6P6MqDJzQ=\n"},
+		{name: "set-compress-base64", args: []string{"set", "compress", "-base64"}, stdin: id2 + "\n" + id1 + "\n" + id3 + "\n" + id1 + "\n"},
+		{name: "set-round-trip", args: []string{"set", "compress"}, stdin: id2 + "\n" + id1 + "\n" + id3 + "\n" + id1 + "\n", then: []string{"set", "decompress"}},
+		{name: "set-round-trip-base64", args: []string{"set", "compress", "-base64"}, stdin: id2 + "\n" + id1 + "\n" + id3 + "\n" + id1 + "\n", then: []string{"set", "decompress", "-base64"}},
+		{name: "set-usage", args: []string{"set", "nope"}, code: 2},
+		{name: "range", args: []string{"range", "-n", "3", "2024-01-01T00:00:00Z", "2024-01-01T00:00:01Z"}},
+		{name: "range-count", args: []string{"range", "-count", id3, id1}},
+		{name: "range-split", args: []string{"range", "-split", "4", "2024-01-01T00:00:00Z", "2024-01-01T00:00:02Z"}},
+		{name: "range-empty", args: []string{"range", id1, id3}, code: 1},
+		{name: "sort", args: []string{"sort", "-u"}, stdin: id2 + "\n" + id1 + "\n" + id3 + "\n" + id1 + "\n"},
+		{name: "merge", args: []string{"merge", "testdata/diff.txt", "testdata/merge.txt", "-"}, stdin: "0ujsswThIGTUYm2K8FjOOfXtY1A\n0ujzPyRiIAffKhBux4PvQdDqMHZ\n"},
+		{name: "merge-unique", args: []string{"merge", "-u", "testdata/diff.txt", "testdata/merge.txt", "-"}, stdin: "0ujsswThIGTUYm2K8FjOOfXtY1A\n0ujzPyRiIAffKhBux4PvQdDqMHZ\n"},
+		{name: "merge-unsorted", args: []string{"merge", "testdata/merge.txt", "-"}, stdin: id2 + "\n" + id1 + "\nnope\n" + id2 + "\n", code: 1},
+		{name: "diff", args: []string{"diff", "-", "testdata/diff.txt"}, stdin: id1 + "\n" + id1 + "\n" + id2 + "\n2aKVLJsgFDYVPFpxqUcVnfna1tQ\n", code: 1},
+		{name: "diff-same", args: []string{"diff", "testdata/diff.txt", "-"}, stdin: id3 + "\n" + id1 + "\n" + id2 + "\n" + id2 + "\n"},
+		{name: "diff-unsorted", args: []string{"diff", "-", "testdata/diff.txt"}, stdin: id2 + "\n" + id1 + "\n", code: 2},
+		{name: "diff-stdin", args: []string{"diff", "-", "-"}, code: 2},
+		{name: "legacy-parse", args: []string{"-f", "timestamp", id1, id2}},
+		{name: "legacy-time-args", args: []string{"-time", "2024-01-01T00:00:00Z", id1}, code: 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+
+			code := run(test.args, strings.NewReader(test.stdin), stdout, stderr)
+			if test.then != nil && code == 0 {
+				in := stdout
+				stdout = &bytes.Buffer{}
+				code = run(test.then, in, stdout, stderr)
+			}
+			if code != test.code {
+				t.Errorf("bad exit code: expected %d but got %d\n%s", test.code, code, stderr)
+			}
+
+			// Errors are part of the output checked against the golden files,
+			// after a separator line.
+			out := stdout.Bytes()
+			if stderr.Len() != 0 {
+				out = append(out, "--- stderr ---\n"...)
+				out = append(out, stderr.Bytes()...)
+			}
+
+			path := filepath.Join("testdata", test.name+".golden")
+
+			if *update {
+				if err := ioutil.WriteFile(path, out, 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+
+			golden, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(out, golden) {
+				t.Errorf("the output does not match %s:\n%s", path, out)
+			}
+		})
+	}
+}
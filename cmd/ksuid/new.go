@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/segmentio/ksuid"
+)
+
+const newHelp = `Generates new KSUIDs. By default, KSUIDs are generated at the current time, the
+-time flag or the -from and -to flags choose other times.`
+
+func newCommand(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	var gen generateOptions
+	var opts formatOptions
+
+	fset := newFlagSet("new", stderr)
+	gen.register(fset)
+	opts.register(fset)
+
+	if code, ok := parseFlags(fset, args); !ok {
+		return code
+	}
+
+	if fset.NArg() != 0 {
+		fset.Usage()
+		return 2
+	}
+
+	return generateKSUIDs(&gen, &opts, stdout, stderr)
+}
+
+// generateKSUIDs prints the KSUIDs generated with the options of gen.
+func generateKSUIDs(gen *generateOptions, opts *formatOptions, stdout, stderr io.Writer) int {
+	if gen.count < 0 {
+		fmt.Fprintln(stderr, "The -n flag cannot be negative:", gen.count)
+		return 2
+	}
+
+	w := bufio.NewWriter(stdout)
+	defer w.Flush()
+
+	print, err := opts.printer(w)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+
+	// The KSUIDs are printed as they are generated, so large values of -n
+	// don't need to hold them all in memory.
+	err = gen.generate(func(id ksuid.KSUID) bool {
+		print(w, id)
+		return opts.err == nil
+	})
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	if opts.failed(stderr) {
+		return 1
+	}
+	return 0
+}
+
+// generateOptions are the flags controlling how KSUIDs are generated.
+type generateOptions struct {
+	count int
+	at    timeFlag
+	from  timeFlag
+	to    timeFlag
+	min   bool
+	max   bool
+}
+
+func (gen *generateOptions) register(fset *flag.FlagSet) {
+	fset.IntVar(&gen.count, "n", 1, "Number of KSUIDs to generate when called with no other arguments.")
+	fset.Var(&gen.at, "time", "Generate KSUIDs at this `time` instead of now (RFC3339).")
+	fset.Var(&gen.from, "from", "Generate KSUIDs with timestamps spread evenly from this `time` (RFC3339, included), requires -to.")
+	fset.Var(&gen.to, "to", "The end `time` of the range set by -from (RFC3339, excluded).")
+	fset.BoolVar(&gen.min, "min", false, "Print the lowest KSUID of the second given by -time.")
+	fset.BoolVar(&gen.max, "max", false, "Print the highest KSUID of the second given by -time.")
+}
+
+// used returns true if any of the flags controlling the time of the KSUIDs was
+// set.
+func (gen *generateOptions) used() bool {
+	return gen.at.set || gen.from.set || gen.to.set || gen.min || gen.max
+}
+
+// generate passes the number of new KSUIDs set by -n, or the boundary KSUIDs
+// requested with -min and -max, to yield as they are generated at the times
+// set by the -time, -from and -to flags. It stops early if yield returns false.
+func (gen *generateOptions) generate(yield func(ksuid.KSUID) bool) error {
+	n := gen.count
+	at, from, to := &gen.at, &gen.from, &gen.to
+
+	switch {
+	case gen.min && gen.max:
+		return errors.New("the -min and -max flags cannot be used together")
+
+	case gen.min || gen.max:
+		if !at.set {
+			return errors.New("the -min and -max flags require -time")
+		}
+		payload := make([]byte, 16)
+		if gen.max {
+			for i := range payload {
+				payload[i] = 0xFF
+			}
+		}
+		id, _ := ksuid.FromParts(at.Time, payload)
+		yield(id)
+		return nil
+
+	case from.set || to.set:
+		if !from.set || !to.set {
+			return errors.New("the -from and -to flags must be used together")
+		}
+		if at.set {
+			return errors.New("the -time flag cannot be used with -from and -to")
+		}
+		if !from.Before(to.Time) {
+			return fmt.Errorf("the time range is empty: %s is not before %s", from, to)
+		}
+	}
+
+	for i := 0; i < n; i++ {
+		var id ksuid.KSUID
+		var err error
+
+		switch {
+		case at.set:
+			id, err = ksuid.NewRandomWithTime(at.Time)
+		case from.set:
+			// Spread the timestamps evenly over the range, the KSUIDs are
+			// generated in chronological order.
+			d := to.Sub(from.Time)
+			id, err = ksuid.NewRandomWithTime(from.Add(time.Duration(float64(d) * float64(i) / float64(n))))
+		default:
+			id, err = ksuid.NewRandom()
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if !yield(id) {
+			break
+		}
+	}
+
+	return nil
+}
+
+// timeFlag is a flag.Value holding a time in RFC3339 format, which must be in
+// the range of times that KSUID timestamps can represent.
+type timeFlag struct {
+	time.Time
+	set bool
+}
+
+func (t *timeFlag) String() string {
+	if !t.set {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+func (t *timeFlag) Set(s string) error {
+	v, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return err
+	}
+	if v.Before(minTime) || v.After(maxTime) {
+		return fmt.Errorf("%s is not within the range of KSUID timestamps (%s to %s)", s, minTime.Format(time.RFC3339), maxTime.Format(time.RFC3339))
+	}
+	t.Time, t.set = v, true
+	return nil
+}
+
+var (
+	minTime = ksuid.Nil.Time().UTC()
+	maxTime = ksuid.Max.Time().UTC()
+)
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+const parseHelp = `Parses KSUIDs and prints them in another format. The KSUIDs are given as
+arguments, or read from stdin, one per line, with the - argument. They are
+accepted in base62 or hexadecimal, those which cannot be parsed are reported and
+the exit code is 1.`
+
+const inspectHelp = `Prints the components of KSUIDs. It is the parse command with the inspect
+format by default.`
+
+func parse(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	return parseWith("parse", "string", args, stdin, stdout, stderr)
+}
+
+func inspect(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	return parseWith("inspect", "inspect", args, stdin, stdout, stderr)
+}
+
+func parseWith(name, format string, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	var opts formatOptions
+
+	fset := newFlagSet(name, stderr)
+	opts.registerDefault(fset, format)
+
+	if code, ok := parseFlags(fset, args); !ok {
+		return code
+	}
+
+	return printKSUIDs(fset.Args(), &opts, stdin, stdout, stderr)
+}
+
+// printKSUIDs prints the KSUIDs given as arguments, or read from stdin when the
+// only argument is -. Invalid KSUIDs are reported and skipped.
+func printKSUIDs(args []string, opts *formatOptions, stdin io.Reader, stdout, stderr io.Writer) int {
+	w := bufio.NewWriter(stdout)
+	defer w.Flush()
+
+	print, err := opts.printer(w)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+
+	failed := false
+
+	if len(args) == 1 && args[0] == "-" {
+		failed = printStream(w, stdin, stderr, print)
+		args = nil
+	}
+
+	for _, arg := range args {
+		id, err := parseKSUID(arg)
+		if err != nil {
+			fmt.Fprintf(stderr, "Error when parsing %q: %s\n", arg, err)
+			failed = true
+			continue
+		}
+		print(w, id)
+	}
+
+	if opts.failed(stderr) || failed {
+		return 1
+	}
+	return 0
+}
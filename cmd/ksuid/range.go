@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math/big"
+	"time"
+
+	"github.com/segmentio/ksuid"
+)
+
+const rangeHelp = `Prints the KSUIDs from LOW to HIGH, both included, in order. The bounds are
+KSUIDs, in base62 or hexadecimal, or times in RFC3339 format. A time as LOW
+starts the range at the first KSUID of that second, a time as HIGH ends it
+before the first KSUID of that second.`
+
+func rangeCommand(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	var opts formatOptions
+
+	fset := newFlagSet("range", stderr)
+	limit := fset.Int("n", 1000, "The maximum number of KSUIDs to print, 0 for no limit.")
+	split := fset.Int("split", 0, "Print the KSUIDs dividing the range in this number of parts of equal size instead.")
+	count := fset.Bool("count", false, "Print the number of KSUIDs in the range instead.")
+	opts.register(fset)
+
+	if code, ok := parseFlags(fset, args); !ok {
+		return code
+	}
+
+	if fset.NArg() != 2 {
+		fset.Usage()
+		return 2
+	}
+
+	lo, err := parseBound(fset.Arg(0), false)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error when parsing %q: %s\n", fset.Arg(0), err)
+		return 2
+	}
+
+	hi, err := parseBound(fset.Arg(1), true)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error when parsing %q: %s\n", fset.Arg(1), err)
+		return 2
+	}
+
+	if ksuid.Compare(lo, hi) > 0 {
+		fmt.Fprintln(stderr, "The range is empty:", lo, "is greater than", hi)
+		return 1
+	}
+
+	w := bufio.NewWriter(stdout)
+	defer w.Flush()
+
+	if *count {
+		d := ksuid.Distance(lo, hi)
+		fmt.Fprintln(w, d.Add(d, big.NewInt(1)))
+		return 0
+	}
+
+	print, err := opts.printer(w)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+
+	if *split != 0 {
+		for _, id := range ksuid.Split(lo, hi, *split) {
+			print(w, id)
+		}
+	} else {
+		it := ksuid.IterRange(lo, hi)
+		for n := 0; (*limit == 0 || n < *limit) && it.Next(); n++ {
+			print(w, it.KSUID)
+		}
+	}
+
+	if opts.failed(stderr) {
+		return 1
+	}
+	return 0
+}
+
+// parseBound parses a bound of the range command. Times are converted to the
+// first KSUID of their second when they start the range, and to the KSUID
+// before it when they end the range.
+func parseBound(s string, high bool) (ksuid.KSUID, error) {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return parseKSUID(s)
+	}
+
+	if t.Before(minTime) || t.After(maxTime) {
+		return ksuid.Nil, fmt.Errorf("the time is not within the range of KSUID timestamps (%s to %s)", minTime.Format(time.RFC3339), maxTime.Format(time.RFC3339))
+	}
+
+	id, err := ksuid.FromParts(t, make([]byte, 16))
+	if err != nil || !high {
+		return id, err
+	}
+
+	if id == ksuid.Nil {
+		return ksuid.Nil, fmt.Errorf("no KSUID is before %s", s)
+	}
+	return id.Prev(), nil
+}
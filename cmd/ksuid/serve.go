@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/segmentio/ksuid"
+)
+
+const serveHelp = `Runs an HTTP server minting KSUIDs, for programs which cannot use the library.
+The server has the following endpoints:
+
+  GET /new?n=N      Returns N new KSUIDs (1 by default), one per line.
+  GET /parse/KSUID  Returns the components of a KSUID, in the json format.
+  POST /compress    Returns the KSUIDs of the request body, one per line, as a
+                    compressed set. Bodies larger than -max-body are rejected.
+
+The server stops gracefully on SIGINT or SIGTERM, waiting for the requests in
+progress to complete.`
+
+func serve(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fset := newFlagSet("serve", stderr)
+	addr := fset.String("addr", "localhost:8080", "The `address` that the server listens on.")
+	max := fset.Int("max", 10000, "The maximum number of KSUIDs returned by a single request to /new.")
+	maxBody := fset.Int64("max-body", 32<<20, "The maximum size of the body of requests to /compress, in bytes.")
+
+	if code, ok := parseFlags(fset, args); !ok {
+		return code
+	}
+
+	if fset.NArg() != 0 {
+		fset.Usage()
+		return 2
+	}
+
+	l, err := net.Listen("tcp", *addr)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	srv := &http.Server{Handler: newHandler(*max, *maxBody)}
+	errc := make(chan error, 1)
+
+	go func() { errc <- srv.Serve(l) }()
+	fmt.Fprintln(stderr, "Listening on", l.Addr())
+
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigc)
+
+	select {
+	case err := <-errc:
+		fmt.Fprintln(stderr, err)
+		return 1
+	case sig := <-sigc:
+		fmt.Fprintf(stderr, "Received %s, shutting down\n", sig)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := srv.Shutdown(ctx); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// newHandler returns the handler of the serve command, which returns at most
+// max KSUIDs per request to /new, and reads at most maxBody bytes per request
+// to /compress.
+func newHandler(max int, maxBody int64) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/new", func(w http.ResponseWriter, r *http.Request) { serveNew(w, r, max) })
+	mux.HandleFunc("/parse/", serveParse)
+	mux.HandleFunc("/compress", func(w http.ResponseWriter, r *http.Request) { serveCompress(w, r, maxBody) })
+	return mux
+}
+
+func serveNew(w http.ResponseWriter, r *http.Request, max int) {
+	if !allowMethod(w, r, "GET") {
+		return
+	}
+
+	n := 1
+	if s := r.URL.Query().Get("n"); s != "" {
+		var err error
+		if n, err = strconv.Atoi(s); err != nil || n < 1 || n > max {
+			http.Error(w, fmt.Sprintf("n must be a number between 1 and %d", max), http.StatusBadRequest)
+			return
+		}
+	}
+
+	b := &bytes.Buffer{}
+	b.Grow(n * (stringEncodedLength + 1))
+
+	for i := 0; i != n; i++ {
+		id, err := ksuid.NewRandom()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		b.WriteString(id.String())
+		b.WriteByte('\n')
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write(b.Bytes())
+}
+
+// The length of KSUIDs in their base62 string representation.
+const stringEncodedLength = 27
+
+func serveParse(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, "GET") {
+		return
+	}
+
+	s := strings.TrimPrefix(r.URL.Path, "/parse/")
+
+	id, err := parseKSUID(s)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error when parsing %q: %s", s, err), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(makeRecord(id))
+}
+
+func serveCompress(w http.ResponseWriter, r *http.Request, maxBody int64) {
+	if !allowMethod(w, r, "POST") {
+		return
+	}
+
+	var ids []ksuid.KSUID
+	errs := &bytes.Buffer{}
+
+	it := lineIter{r: bufio.NewReader(http.MaxBytesReader(w, r.Body, maxBody)), errw: errs}
+	for it.Next() {
+		ids = append(ids, it.KSUID)
+	}
+
+	// Reading the body fails when it is larger than the limit, or when the
+	// client went away, in which case nobody reads the response.
+	if it.err != nil && it.err != io.EOF {
+		http.Error(w, fmt.Sprintf("The request body is larger than %d bytes", maxBody), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	if it.failed {
+		http.Error(w, strings.TrimSpace(errs.String()), http.StatusBadRequest)
+		return
+	}
+
+	b, _ := ksuid.Compress(ids...).MarshalBinary()
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Write(b)
+}
+
+// allowMethod writes a 405 response to w and returns false if r does not use
+// the given method.
+func allowMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method == method || (method == "GET" && r.Method == "HEAD") {
+		return true
+	}
+	w.Header().Set("Allow", method)
+	http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	return false
+}
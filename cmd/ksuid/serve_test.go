@@ -0,0 +1,170 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/segmentio/ksuid"
+)
+
+func TestServe(t *testing.T) {
+	srv := httptest.NewServer(newHandler(100, 1000))
+	defer srv.Close()
+
+	const (
+		id1 = "0ujtsYcgvSTl8PAuAdqWYSMnLOv"
+		id2 = "0ujzPyRiIAffKhBux4PvQdDqMHY"
+	)
+
+	compressed, _ := ksuid.Compress(ksuid.ParseOrNil(id1), ksuid.ParseOrNil(id2)).MarshalBinary()
+
+	tests := []struct {
+		scenario string
+		method   string
+		path     string
+		body     string
+		status   int
+		check    func(*testing.T, string)
+	}{
+		{
+			scenario: "GET /new returns one KSUID by default",
+			method:   "GET",
+			path:     "/new",
+			status:   http.StatusOK,
+			check:    testKSUIDLines(1),
+		},
+		{
+			scenario: "GET /new returns the number of KSUIDs given by n",
+			method:   "GET",
+			path:     "/new?n=100",
+			status:   http.StatusOK,
+			check:    testKSUIDLines(100),
+		},
+		{
+			scenario: "GET /new rejects n above the maximum",
+			method:   "GET",
+			path:     "/new?n=101",
+			status:   http.StatusBadRequest,
+		},
+		{
+			scenario: "GET /new rejects invalid numbers",
+			method:   "GET",
+			path:     "/new?n=nope",
+			status:   http.StatusBadRequest,
+		},
+		{
+			scenario: "POST /new is not allowed",
+			method:   "POST",
+			path:     "/new",
+			status:   http.StatusMethodNotAllowed,
+		},
+		{
+			scenario: "GET /parse returns the components of a KSUID",
+			method:   "GET",
+			path:     "/parse/" + id1,
+			status:   http.StatusOK,
+			check: testBody(`{"string":"0ujtsYcgvSTl8PAuAdqWYSMnLOv","hex":"0669F7EFB5A1CD34B5F99D1154FB6853345C9735",` +
+				`"time":"2017-10-10T04:00:47Z","timestamp":107608047,"payload":"B5A1CD34B5F99D1154FB6853345C9735"}` + "\n"),
+		},
+		{
+			scenario: "GET /parse accepts hexadecimal KSUIDs",
+			method:   "GET",
+			path:     "/parse/0669F7EFB5A1CD34B5F99D1154FB6853345C9735",
+			status:   http.StatusOK,
+		},
+		{
+			scenario: "GET /parse rejects invalid KSUIDs",
+			method:   "GET",
+			path:     "/parse/nope",
+			status:   http.StatusBadRequest,
+		},
+		{
+			scenario: "POST /compress returns a compressed set",
+			method:   "POST",
+			path:     "/compress",
+			body:     id2 + "\n" + id1 + "\n",
+			status:   http.StatusOK,
+			check:    testBody(string(compressed)),
+		},
+		{
+			scenario: "POST /compress rejects invalid KSUIDs",
+			method:   "POST",
+			path:     "/compress",
+			body:     id1 + "\nnope\n",
+			status:   http.StatusBadRequest,
+			check:    testBody("Error when parsing \"nope\" on line 2: Valid encoded KSUIDs are 27 characters\n"),
+		},
+		{
+			scenario: "POST /compress rejects bodies larger than the limit",
+			method:   "POST",
+			path:     "/compress",
+			body:     strings.Repeat(id1+"\n", 1000/28+1),
+			status:   http.StatusRequestEntityTooLarge,
+		},
+		{
+			scenario: "POST /compress accepts bodies up to the limit",
+			method:   "POST",
+			path:     "/compress",
+			body:     strings.Repeat(id1+"\n", 1000/28),
+			status:   http.StatusOK,
+		},
+		{
+			scenario: "GET /compress is not allowed",
+			method:   "GET",
+			path:     "/compress",
+			status:   http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.scenario, func(t *testing.T) {
+			req, err := http.NewRequest(test.method, srv.URL+test.path, strings.NewReader(test.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			res, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+
+			b, err := ioutil.ReadAll(res.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if res.StatusCode != test.status {
+				t.Errorf("bad status: expected %d but got %d: %s", test.status, res.StatusCode, b)
+			}
+			if test.check != nil {
+				test.check(t, string(b))
+			}
+		})
+	}
+}
+
+func testKSUIDLines(n int) func(*testing.T, string) {
+	return func(t *testing.T, body string) {
+		lines := strings.Split(strings.TrimSuffix(body, "\n"), "\n")
+		if len(lines) != n {
+			t.Errorf("bad number of KSUIDs: expected %d but got %d", n, len(lines))
+		}
+		for _, line := range lines {
+			if _, err := ksuid.Parse(line); err != nil {
+				t.Errorf("bad KSUID %q: %s", line, err)
+			}
+		}
+	}
+}
+
+func testBody(expected string) func(*testing.T, string) {
+	return func(t *testing.T, body string) {
+		if body != expected {
+			t.Errorf("bad body:\nexpected: %q\n     got: %q", expected, body)
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/segmentio/ksuid"
+)
+
+const setHelp = `Compresses and decompresses sets of KSUIDs. Sets are in the container format of
+CompressedSet.MarshalBinary. The compress subcommand reads KSUIDs from the
+files, or stdin, one per line, and writes them as a compressed set. The
+decompress subcommand reads a compressed set and prints its KSUIDs, the stats
+subcommand prints statistics about it.`
+
+// setCommands are the subcommands of the set command.
+var setCommands = map[string]func([]string, io.Reader, io.Writer, io.Writer) int{
+	"compress":   compress,
+	"decompress": decompress,
+	"stats":      setStats,
+}
+
+func set(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) != 0 {
+		if cmd, ok := setCommands[args[0]]; ok {
+			return cmd(args[1:], stdin, stdout, stderr)
+		}
+	}
+
+	fset := newFlagSet("set", stderr)
+
+	if code, ok := parseFlags(fset, args); !ok {
+		return code
+	}
+
+	fset.Usage()
+	return 2
+}
+
+const compressHelp = `Reads KSUIDs from the files, or stdin, one per line, and writes them as a
+compressed set.`
+
+// compress reads KSUIDs from files or stdin and writes them to stdout as a
+// compressed set, in the container format of CompressedSet.MarshalBinary.
+func compress(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fset := newFlagSet("compress", stderr)
+	b64 := fset.Bool("base64", false, "Write the set encoded in base64.")
+
+	if code, ok := parseFlags(fset, args); !ok {
+		return code
+	}
+
+	var ids []ksuid.KSUID
+
+	failed := false
+	err := readInputs(fset.Args(), stdin, func(r io.Reader) {
+		failed = scanKSUIDs(bufio.NewReader(r), stderr, func(id ksuid.KSUID) {
+			ids = append(ids, id)
+		}) || failed
+	})
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	b, _ := ksuid.Compress(ids...).MarshalBinary()
+
+	if *b64 {
+		b = append([]byte(base64.StdEncoding.EncodeToString(b)), '\n')
+	}
+
+	if _, err := stdout.Write(b); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+const decompressHelp = `Reads a compressed set from the file, or stdin, and prints its KSUIDs.`
+
+// decompress reads a compressed set from a file or stdin and prints its
+// KSUIDs, one per line.
+func decompress(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	var opts formatOptions
+
+	fset := newFlagSet("decompress", stderr)
+	b64 := fset.Bool("base64", false, "Read the set encoded in base64.")
+	opts.register(fset)
+
+	if code, ok := parseFlags(fset, args); !ok {
+		return code
+	}
+
+	w := bufio.NewWriter(stdout)
+	defer w.Flush()
+
+	set, _, err := readSet(fset.Args(), stdin, *b64)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	print, err := opts.printer(w)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+
+	it := set.Iter()
+	for it.Next() {
+		print(w, it.KSUID)
+	}
+
+	if err := it.Err(); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	if opts.failed(stderr) {
+		return 1
+	}
+	return 0
+}
+
+const setStatsHelp = `Reads a compressed set from the file, or stdin, and prints statistics about it.`
+
+// setStats reads a compressed set from a file or stdin and prints a summary of
+// its content.
+func setStats(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fset := newFlagSet("set-stats", stderr)
+	b64 := fset.Bool("base64", false, "Read the set encoded in base64.")
+
+	if code, ok := parseFlags(fset, args); !ok {
+		return code
+	}
+
+	set, size, err := readSet(fset.Args(), stdin, *b64)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	s := makeSetStats(set)
+	if s.err != nil {
+		fmt.Fprintln(stderr, s.err)
+		return 1
+	}
+
+	ratio, perKSUID := 0.0, 0.0
+	if s.count != 0 {
+		ratio = float64(s.count*len(ksuid.Nil)) / float64(size)
+		perKSUID = float64(size) / float64(s.count)
+	}
+
+	const statsFormat = `  Count: %d
+    Min: %s
+    Max: %s
+   Runs: %d
+   Size: %d bytes
+  Ratio: %.2f (%.2f bytes per KSUID)
+`
+	fmt.Fprintf(stdout, statsFormat, s.count, s.min, s.max, s.runs, size, ratio, perKSUID)
+	return 0
+}
+
+type setStatsResult struct {
+	count int
+	min   ksuid.KSUID
+	max   ksuid.KSUID
+	runs  int // sequences of consecutive KSUIDs
+	err   error
+}
+
+func makeSetStats(set ksuid.CompressedSet) (s setStatsResult) {
+	it := set.Iter()
+
+	for it.Next() {
+		if s.count == 0 {
+			s.min = it.KSUID
+		}
+		if s.count == 0 || it.KSUID != s.max.Next() {
+			s.runs++
+		}
+		s.max = it.KSUID
+		s.count++
+	}
+
+	s.err = it.Err()
+	return
+}
+
+// readSet reads a compressed set from the file given as argument, or stdin if
+// there are none. It returns the set and the size of its encoded form.
+func readSet(args []string, stdin io.Reader, b64 bool) (ksuid.CompressedSet, int, error) {
+	if len(args) > 1 {
+		return nil, 0, errors.New("only one compressed set can be read at a time")
+	}
+
+	var b []byte
+	var err error
+
+	if len(args) == 0 || args[0] == "-" {
+		b, err = ioutil.ReadAll(stdin)
+	} else {
+		b, err = ioutil.ReadFile(args[0])
+	}
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if b64 {
+		b, err = base64.StdEncoding.DecodeString(string(bytes.TrimSpace(b)))
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	var set ksuid.CompressedSet
+	if err := set.UnmarshalBinary(b); err != nil {
+		return nil, 0, err
+	}
+
+	return set, len(b), nil
+}
+
+// readInputs calls fn with each file given as argument, or stdin if there are
+// none. The - argument also stands for stdin.
+func readInputs(args []string, stdin io.Reader, fn func(io.Reader)) error {
+	if len(args) == 0 {
+		args = []string{"-"}
+	}
+
+	for _, arg := range args {
+		if arg == "-" {
+			fn(stdin)
+			continue
+		}
+
+		f, err := os.Open(arg)
+		if err != nil {
+			return err
+		}
+		fn(f)
+		f.Close()
+	}
+
+	return nil
+}
@@ -205,6 +205,19 @@ func timeToCorrectedUTCTimestamp(t time.Time) uint32 {
 	return uint32(t.Unix() - epochStamp)
 }
 
+// timeToClampedTimestamp is like timeToCorrectedUTCTimestamp, but times out of
+// the range of KSUID timestamps are clamped to it instead of wrapping around.
+func timeToClampedTimestamp(t time.Time) uint32 {
+	switch s := t.Unix() - epochStamp; {
+	case s < 0:
+		return 0
+	case s > math.MaxUint32:
+		return math.MaxUint32
+	default:
+		return uint32(s)
+	}
+}
+
 func correctedUTCTimestampToTime(ts uint32) time.Time {
 	return time.Unix(int64(ts)+epochStamp, 0)
 }
@@ -311,8 +324,12 @@ func Compare(a, b KSUID) int {
 }
 
 // Sorts the given slice of KSUIDs
+//
+// The slice is sorted in place with a radix sort, which runs in linear time
+// regardless of the initial order of the KSUIDs. Use ParallelSort to sort very
+// large slices on multiple CPU cores.
 func Sort(ids []KSUID) {
-	quickSort(ids, 0, len(ids)-1)
+	radixSort(ids, 0)
 }
 
 // IsSorted checks whether a slice of KSUIDs is sorted
@@ -329,28 +346,6 @@ func IsSorted(ids []KSUID) bool {
 	return true
 }
 
-func quickSort(a []KSUID, lo int, hi int) {
-	if lo < hi {
-		pivot := a[hi]
-		i := lo - 1
-
-		for j, n := lo, hi; j != n; j++ {
-			if bytes.Compare(a[j][:], pivot[:]) < 0 {
-				i++
-				a[i], a[j] = a[j], a[i]
-			}
-		}
-
-		i++
-		if bytes.Compare(a[hi][:], a[i][:]) < 0 {
-			a[i], a[hi] = a[hi], a[i]
-		}
-
-		quickSort(a, lo, i-1)
-		quickSort(a, i+1, hi)
-	}
-}
-
 // Next returns the next KSUID after id.
 func (id KSUID) Next() KSUID {
 	zero := makeUint128(0, 0)
@@ -0,0 +1,251 @@
+package ksuid
+
+import "bytes"
+
+// Iterator is the interface implemented by the iterator types of this package
+// (CompressedSetIter, CompressedSetReader, MutableSetIter, SliceIter, MergeIter
+// and RangeIter) to produce sequences of KSUIDs.
+//
+// Next moves the iterator to the next KSUID and returns false when there are
+// none left, ID returns the KSUID that the iterator is positioned on.
+type Iterator interface {
+	Next() bool
+	ID() KSUID
+}
+
+// Merge appends the KSUIDs of the sorted lists to dst, in order, and returns
+// the extended slice. KSUIDs that appear in more than one list are appended as
+// many times, use Dedup on the result to remove them.
+func Merge(dst []KSUID, lists ...[]KSUID) []KSUID {
+	h := make(sliceHeap, 0, len(lists))
+	n := 0
+
+	for _, list := range lists {
+		if len(list) != 0 {
+			h = append(h, list)
+			n += len(list)
+		}
+	}
+
+	if cap(dst)-len(dst) < n {
+		c := make([]KSUID, len(dst), len(dst)+n)
+		copy(c, dst)
+		dst = c
+	}
+
+	switch len(h) {
+	case 0:
+		return dst
+	case 1:
+		return append(dst, h[0]...)
+	case 2:
+		return mergeSorted(dst, h[0], h[1])
+	}
+
+	h.init()
+
+	for len(h) > 1 {
+		dst = append(dst, h[0][0])
+
+		if h[0] = h[0][1:]; len(h[0]) == 0 {
+			last := len(h) - 1
+			h[0], h = h[last], h[:last]
+		}
+
+		h.down(0)
+	}
+
+	return append(dst, h[0]...)
+}
+
+// Dedup removes consecutive duplicates from ids, which leaves only unique
+// KSUIDs if ids is sorted. The slice is modified in place, and the prefix
+// holding the remaining KSUIDs is returned.
+func Dedup(ids []KSUID) []KSUID {
+	if len(ids) < 2 {
+		return ids
+	}
+
+	n := 1
+
+	for _, id := range ids[1:] {
+		if id != ids[n-1] {
+			ids[n] = id
+			n++
+		}
+	}
+
+	return ids[:n]
+}
+
+// SliceIter is an iterator type returned by IterSlice to produce the KSUIDs of
+// a slice through the Iterator interface.
+type SliceIter struct {
+	// KSUID is modified by calls to the Next method to hold the KSUID loaded
+	// by the iterator.
+	KSUID KSUID
+
+	ids []KSUID
+}
+
+// IterSlice returns an iterator that produces the KSUIDs of ids, in the order
+// they appear in the slice.
+func IterSlice(ids []KSUID) SliceIter {
+	return SliceIter{ids: ids}
+}
+
+// Next moves the iterator forward, returning true if there a KSUID was found,
+// or false if the iterator as reached the end of the slice.
+func (it *SliceIter) Next() bool {
+	if len(it.ids) == 0 {
+		return false
+	}
+	it.KSUID, it.ids = it.ids[0], it.ids[1:]
+	return true
+}
+
+// ID returns the KSUID that the iterator is positioned on.
+func (it *SliceIter) ID() KSUID {
+	return it.KSUID
+}
+
+// MergeIter is an iterator type returned by MergeIters to produce the KSUIDs
+// of multiple sorted iterators, in order.
+//
+// MergeIter values are not safe to use concurrently from multiple goroutines.
+type MergeIter struct {
+	// KSUID is modified by calls to the Next method to hold the KSUID loaded
+	// by the iterator.
+	KSUID KSUID
+
+	iters   []Iterator
+	heap    iterHeap
+	started bool
+}
+
+// MergeIters returns an iterator that produces the KSUIDs of all iterators,
+// which must each produce KSUIDs in order. Like Merge, KSUIDs produced by more
+// than one iterator appear as many times.
+//
+// The iterators are advanced by the returned MergeIter and must not be used
+// directly after calling MergeIters.
+func MergeIters(iters ...Iterator) MergeIter {
+	return MergeIter{
+		iters: iters,
+		heap:  make(iterHeap, 0, len(iters)),
+	}
+}
+
+// Next moves the iterator forward, returning true if there a KSUID was found,
+// or false if all the merged iterators have reached their end.
+func (it *MergeIter) Next() bool {
+	if !it.started {
+		it.started = true
+
+		for _, iter := range it.iters {
+			if iter.Next() {
+				it.heap = append(it.heap, iterHead{id: iter.ID(), iter: iter})
+			}
+		}
+
+		it.heap.init()
+	} else if len(it.heap) != 0 {
+		if head := &it.heap[0]; head.iter.Next() {
+			head.id = head.iter.ID()
+		} else {
+			last := len(it.heap) - 1
+			it.heap[0], it.heap = it.heap[last], it.heap[:last]
+		}
+
+		it.heap.down(0)
+	}
+
+	if len(it.heap) == 0 {
+		return false
+	}
+
+	it.KSUID = it.heap[0].id
+	return true
+}
+
+// ID returns the KSUID that the iterator is positioned on.
+func (it *MergeIter) ID() KSUID {
+	return it.KSUID
+}
+
+// Err returns the first error reported by one of the merged iterators which
+// have an Err method, like CompressedSetIter or CompressedSetReader.
+func (it *MergeIter) Err() error {
+	for _, iter := range it.iters {
+		if e, ok := iter.(interface{ Err() error }); ok {
+			if err := e.Err(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// sliceHeap is a min-heap of non-empty sorted slices, ordered by their first
+// KSUID.
+type sliceHeap [][]KSUID
+
+func (h sliceHeap) init() {
+	for i := len(h)/2 - 1; i >= 0; i-- {
+		h.down(i)
+	}
+}
+
+func (h sliceHeap) down(i int) {
+	for {
+		min := i
+		if l := 2*i + 1; l < len(h) && bytes.Compare(h[l][0][:], h[min][0][:]) < 0 {
+			min = l
+		}
+		if r := 2*i + 2; r < len(h) && bytes.Compare(h[r][0][:], h[min][0][:]) < 0 {
+			min = r
+		}
+		if min == i {
+			return
+		}
+		h[i], h[min] = h[min], h[i]
+		i = min
+	}
+}
+
+// iterHeap is a min-heap of iterators, ordered by the KSUID they are
+// positioned on. The KSUIDs are cached to avoid calling the ID method of the
+// iterators on every comparison.
+type iterHeap []iterHead
+
+type iterHead struct {
+	id   KSUID
+	iter Iterator
+}
+
+func (h iterHeap) init() {
+	for i := len(h)/2 - 1; i >= 0; i-- {
+		h.down(i)
+	}
+}
+
+func (h iterHeap) down(i int) {
+	for {
+		min := i
+		if l := 2*i + 1; l < len(h) && h.less(l, min) {
+			min = l
+		}
+		if r := 2*i + 2; r < len(h) && h.less(r, min) {
+			min = r
+		}
+		if min == i {
+			return
+		}
+		h[i], h[min] = h[min], h[i]
+		i = min
+	}
+}
+
+func (h iterHeap) less(i, j int) bool {
+	return bytes.Compare(h[i].id[:], h[j].id[:]) < 0
+}
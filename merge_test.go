@@ -0,0 +1,198 @@
+package ksuid
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+// makeLists splits n new KSUIDs in k sorted lists, some KSUIDs appearing in
+// more than one list. It returns the lists and their sorted concatenation.
+func makeLists(n int, k int) ([][]KSUID, []KSUID) {
+	lists := make([][]KSUID, k)
+	all := make([]KSUID, 0, n+n/10)
+
+	for i := 0; i < n; i++ {
+		id := New()
+		lists[i%k] = append(lists[i%k], id)
+		all = append(all, id)
+
+		if i%10 == 0 {
+			lists[(i+1)%k] = append(lists[(i+1)%k], id)
+			all = append(all, id)
+		}
+	}
+
+	for _, list := range lists {
+		Sort(list)
+	}
+
+	Sort(all)
+	return lists, all
+}
+
+func TestMerge(t *testing.T) {
+	for _, k := range []int{0, 1, 2, 3, 10} {
+		t.Run(fmt.Sprintf("merging %d lists", k), func(t *testing.T) {
+			lists, all := makeLists(1000*k, k)
+			lists = append(lists, nil) // empty lists are ignored
+			prefix := []KSUID{Max}
+
+			merged := Merge(append([]KSUID{}, prefix...), lists...)
+
+			if merged[0] != Max {
+				t.Fatal("the content of the destination slice was not preserved")
+			}
+			testKSUIDs(t, all, merged[1:])
+		})
+	}
+}
+
+func TestDedup(t *testing.T) {
+	a, b, c := New(), New(), New()
+
+	tests := []struct {
+		scenario string
+		ids      []KSUID
+		expect   []KSUID
+	}{
+		{
+			scenario: "nil",
+		},
+		{
+			scenario: "single",
+			ids:      []KSUID{a},
+			expect:   []KSUID{a},
+		},
+		{
+			scenario: "unique",
+			ids:      []KSUID{a, b, c},
+			expect:   []KSUID{a, b, c},
+		},
+		{
+			scenario: "duplicates",
+			ids:      []KSUID{a, a, b, c, c, c},
+			expect:   []KSUID{a, b, c},
+		},
+		{
+			scenario: "all duplicates",
+			ids:      []KSUID{a, a, a},
+			expect:   []KSUID{a},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.scenario, func(t *testing.T) {
+			testKSUIDs(t, test.expect, Dedup(test.ids))
+		})
+	}
+}
+
+func TestMergeIters(t *testing.T) {
+	lists, all := makeLists(10000, 5)
+
+	set := Compress(lists[0]...)
+	mutable := NewMutableSet(Compress(lists[1]...), 0)
+	reader := NewCompressedSetReader(bytes.NewReader(Compress(lists[2]...)))
+	slice := IterSlice(lists[3])
+	nested := MergeIters(func() *SliceIter { it := IterSlice(lists[4]); return &it }())
+
+	setIter := set.Iter()
+	mutableIter := mutable.Iter()
+	it := MergeIters(&setIter, &mutableIter, reader, &slice, &nested)
+
+	merged := []KSUID{}
+	for it.Next() {
+		if it.ID() != it.KSUID {
+			t.Fatal("the ID method and the KSUID field do not match")
+		}
+		merged = append(merged, it.KSUID)
+	}
+
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	testKSUIDs(t, all, merged)
+
+	t.Run("errors of the merged iterators are reported", func(t *testing.T) {
+		malformed := CompressedSet{payloadDelta | 17}
+		iter := malformed.Iter()
+		slice := IterSlice(lists[0])
+		it := MergeIters(&slice, &iter)
+
+		n := 0
+		for it.Next() {
+			n++
+		}
+
+		if n != len(lists[0]) {
+			t.Errorf("expected %d KSUIDs but got %d", len(lists[0]), n)
+		}
+		if err := it.Err(); err != errSetMalformed {
+			t.Errorf("expected a malformed set error but got %v", err)
+		}
+	})
+
+	t.Run("merging no iterators produces nothing", func(t *testing.T) {
+		it := MergeIters()
+		if it.Next() {
+			t.Error("a KSUID was produced by an empty merge")
+		}
+	})
+}
+
+func testKSUIDs(t *testing.T, expect []KSUID, found []KSUID) {
+	t.Helper()
+
+	if len(expect) != len(found) {
+		t.Fatalf("expected %d KSUIDs but found %d", len(expect), len(found))
+	}
+
+	for i := range expect {
+		if expect[i] != found[i] {
+			t.Fatalf("bad KSUID at index %d: expected %s but found %s", i, expect[i], found[i])
+		}
+	}
+}
+
+func BenchmarkMerge(b *testing.B) {
+	for _, k := range []int{2, 8, 64} {
+		lists, all := makeLists(1000000, k)
+		dst := make([]KSUID, 0, len(all))
+
+		b.Run(fmt.Sprintf("%d lists", k), func(b *testing.B) {
+			b.Run("Merge", func(b *testing.B) {
+				for i := 0; i != b.N; i++ {
+					Merge(dst, lists...)
+				}
+				b.SetBytes(int64(len(all) * byteLength))
+			})
+
+			b.Run("MergeIters", func(b *testing.B) {
+				iters := make([]SliceIter, k)
+				ptrs := make([]Iterator, k)
+
+				for i := 0; i != b.N; i++ {
+					for j := range iters {
+						iters[j] = IterSlice(lists[j])
+						ptrs[j] = &iters[j]
+					}
+					for it := MergeIters(ptrs...); it.Next(); {
+					}
+				}
+				b.SetBytes(int64(len(all) * byteLength))
+			})
+
+			b.Run("concatenate and sort", func(b *testing.B) {
+				for i := 0; i != b.N; i++ {
+					ids := dst[:0]
+					for _, list := range lists {
+						ids = append(ids, list...)
+					}
+					Sort(ids)
+				}
+				b.SetBytes(int64(len(all) * byteLength))
+			})
+		})
+	}
+}
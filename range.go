@@ -0,0 +1,142 @@
+package ksuid
+
+import (
+	"math/big"
+	"time"
+)
+
+// Distance returns the number of KSUIDs between a and b, computed as b - a over
+// the 160 bits integers represented by the KSUIDs. The result is negative if b
+// is lower than a, and the number of KSUIDs in the interval [a, b] is one more
+// than the distance.
+func Distance(a, b KSUID) *big.Int {
+	x := new(big.Int).SetBytes(a[:])
+	y := new(big.Int).SetBytes(b[:])
+	return y.Sub(y, x)
+}
+
+// Split divides the interval [lo, hi] in n parts of equal size, returning the
+// n-1 KSUIDs that start the parts after the first one, in order. It returns nil
+// if n is lower than two or hi is lower than lo.
+//
+// The parts are [lo, ids[0]), [ids[0], ids[1]), ..., [ids[n-2], hi], which is
+// useful to distribute scans of a range of KSUIDs across n workers. Because the
+// payload of KSUIDs is random, parts of equal size hold a similar number of
+// KSUIDs. If the interval holds fewer than n KSUIDs, some parts are empty and
+// the returned slice has duplicates.
+func Split(lo, hi KSUID, n int) []KSUID {
+	if n < 2 || Compare(lo, hi) > 0 {
+		return nil
+	}
+
+	x := new(big.Int).SetBytes(lo[:])
+	d := Distance(lo, hi)
+	d.Add(d, big.NewInt(1))
+
+	ids := make([]KSUID, n-1)
+	q := new(big.Int)
+
+	for i := range ids {
+		q.Mul(d, big.NewInt(int64(i+1)))
+		q.Quo(q, big.NewInt(int64(n)))
+		q.Add(q, x)
+		b := q.Bytes()
+		copy(ids[i][byteLength-len(b):], b)
+	}
+
+	return ids
+}
+
+// SplitByTime is like Split but divides the interval of KSUIDs generated from
+// time from (included) to time to (excluded), both truncated to the second like
+// KSUID timestamps. Parts of equal size cover equal durations, a boundary which
+// falls within a second is placed at the same fraction of the payload space.
+func SplitByTime(from, to time.Time, n int) []KSUID {
+	max := minKSUIDAt(to)
+	if !from.Before(to) || max == Nil { // no KSUIDs are generated before Nil
+		return nil
+	}
+	return Split(minKSUIDAt(from), max.Prev(), n)
+}
+
+// Add returns the KSUID n positions after id. The payload carries into the
+// timestamp, so the result may have been generated in a later second. Like
+// Next, it wraps around to Nil past Max.
+func Add(id KSUID, n uint64) KSUID {
+	t := id.Timestamp()
+	u := uint128Payload(id)
+	v := add128(u, makeUint128(0, n))
+
+	if cmp128(v, u) < 0 { // overflow
+		t++
+	}
+
+	return v.ksuid(t)
+}
+
+// Sub returns the KSUID n positions before id. The payload borrows from the
+// timestamp, so the result may have been generated in an earlier second. Like
+// Prev, it wraps around to Max past Nil.
+func Sub(id KSUID, n uint64) KSUID {
+	t := id.Timestamp()
+	u := uint128Payload(id)
+	v := sub128(u, makeUint128(0, n))
+
+	if cmp128(v, u) > 0 { // underflow
+		t--
+	}
+
+	return v.ksuid(t)
+}
+
+// RangeIter is an iterator type returned by IterRange to produce all KSUIDs of
+// an interval.
+//
+// RangeIter values are not safe to use concurrently from multiple goroutines.
+type RangeIter struct {
+	// KSUID is modified by calls to the Next method to hold the KSUID loaded
+	// by the iterator.
+	KSUID KSUID
+
+	next KSUID
+	last KSUID
+	done bool
+}
+
+// IterRange returns an iterator that produces all KSUIDs from a to b, both
+// included, in order. The iterator produces nothing if b is lower than a.
+//
+// The interval may hold more KSUIDs than can ever be iterated over, use
+// Distance to know how many there are.
+func IterRange(a, b KSUID) RangeIter {
+	return RangeIter{
+		next: a,
+		last: b,
+		done: Compare(a, b) > 0,
+	}
+}
+
+// Next moves the iterator forward, returning true if there a KSUID was found,
+// or false if the iterator as reached the end of the interval.
+func (it *RangeIter) Next() bool {
+	if it.done {
+		return false
+	}
+
+	it.KSUID = it.next
+
+	// Checking for the last KSUID instead of comparing the next one with it
+	// ensures the iterator stops at Max, where Next would wrap around.
+	if it.next == it.last {
+		it.done = true
+	} else {
+		it.next = it.next.Next()
+	}
+
+	return true
+}
+
+// ID returns the KSUID that the iterator is positioned on.
+func (it *RangeIter) ID() KSUID {
+	return it.KSUID
+}
@@ -0,0 +1,291 @@
+package ksuid
+
+import (
+	"math"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAddSub(t *testing.T) {
+	maxPayload := KSUID{0, 0, 0, 1, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+
+	tests := []struct {
+		scenario string
+		id       KSUID
+		n        uint64
+		sum      KSUID
+	}{
+		{
+			scenario: "zero",
+			id:       maxPayload,
+			n:        0,
+			sum:      maxPayload,
+		},
+		{
+			scenario: "within the low half of the payload",
+			id:       Nil,
+			n:        42,
+			sum:      KSUID{19: 42},
+		},
+		{
+			scenario: "carry into the high half of the payload",
+			id:       KSUID{12: 0xff, 13: 0xff, 14: 0xff, 15: 0xff, 16: 0xff, 17: 0xff, 18: 0xff, 19: 0xff},
+			n:        1,
+			sum:      KSUID{11: 1},
+		},
+		{
+			scenario: "carry into the timestamp",
+			id:       maxPayload,
+			n:        2,
+			sum:      KSUID{3: 2, 19: 1},
+		},
+		{
+			scenario: "largest offset",
+			id:       Nil,
+			n:        math.MaxUint64,
+			sum:      KSUID{12: 0xff, 13: 0xff, 14: 0xff, 15: 0xff, 16: 0xff, 17: 0xff, 18: 0xff, 19: 0xff},
+		},
+		{
+			scenario: "wrap around past Max",
+			id:       Max,
+			n:        1,
+			sum:      Nil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.scenario, func(t *testing.T) {
+			if sum := Add(test.id, test.n); sum != test.sum {
+				t.Errorf("bad sum: expected %x but got %x", test.sum, sum)
+			}
+			if diff := Sub(test.sum, test.n); diff != test.id {
+				t.Errorf("bad difference: expected %x but got %x", test.id, diff)
+			}
+		})
+	}
+
+	t.Run("adding and subtracting one matches Next and Prev", func(t *testing.T) {
+		for _, id := range []KSUID{Nil, Max, maxPayload, New()} {
+			if Add(id, 1) != id.Next() {
+				t.Errorf("Add(%x, 1) != Next", id)
+			}
+			if Sub(id, 1) != id.Prev() {
+				t.Errorf("Sub(%x, 1) != Prev", id)
+			}
+		}
+	})
+}
+
+func TestDistance(t *testing.T) {
+	id := New()
+	max := new(big.Int).Lsh(big.NewInt(1), 8*byteLength)
+	max.Sub(max, big.NewInt(1))
+
+	tests := []struct {
+		scenario string
+		a        KSUID
+		b        KSUID
+		distance *big.Int
+	}{
+		{
+			scenario: "same KSUID",
+			a:        id,
+			b:        id,
+			distance: big.NewInt(0),
+		},
+		{
+			scenario: "next KSUID",
+			a:        id,
+			b:        id.Next(),
+			distance: big.NewInt(1),
+		},
+		{
+			scenario: "previous KSUID",
+			a:        id,
+			b:        id.Prev(),
+			distance: big.NewInt(-1),
+		},
+		{
+			scenario: "across timestamps",
+			a:        id,
+			b:        Add(id, math.MaxUint64).Next(),
+			distance: new(big.Int).Add(new(big.Int).SetUint64(math.MaxUint64), big.NewInt(1)),
+		},
+		{
+			scenario: "whole key space",
+			a:        Nil,
+			b:        Max,
+			distance: max,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.scenario, func(t *testing.T) {
+			if d := Distance(test.a, test.b); d.Cmp(test.distance) != 0 {
+				t.Errorf("bad distance: expected %s but got %s", test.distance, d)
+			}
+		})
+	}
+}
+
+func TestIterRange(t *testing.T) {
+	maxPayload := KSUID{0, 0, 0, 1, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+
+	tests := []struct {
+		scenario string
+		a        KSUID
+		b        KSUID
+		count    int
+	}{
+		{
+			scenario: "single KSUID",
+			a:        maxPayload,
+			b:        maxPayload,
+			count:    1,
+		},
+		{
+			scenario: "empty interval",
+			a:        maxPayload,
+			b:        maxPayload.Prev(),
+			count:    0,
+		},
+		{
+			scenario: "across timestamps",
+			a:        Sub(maxPayload, 9),
+			b:        Add(maxPayload, 10),
+			count:    20,
+		},
+		{
+			scenario: "up to Max",
+			a:        Sub(Max, 4),
+			b:        Max,
+			count:    5,
+		},
+		{
+			scenario: "from Nil",
+			a:        Nil,
+			b:        Add(Nil, 4),
+			count:    5,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.scenario, func(t *testing.T) {
+			n := 0
+			prev := test.a.Prev()
+
+			for it := IterRange(test.a, test.b); it.Next(); n++ {
+				if n > test.count {
+					t.Fatal("too many KSUIDs were produced by the range iterator")
+				}
+				if it.KSUID != prev.Next() {
+					t.Fatalf("bad KSUID at index %d: expected %x but got %x", n, prev.Next(), it.KSUID)
+				}
+				prev = it.KSUID
+			}
+
+			if n != test.count {
+				t.Errorf("expected %d KSUIDs but got %d", test.count, n)
+			}
+			if d := Distance(test.a, test.b); d.Int64()+1 != int64(n) && n != 0 {
+				t.Errorf("the distance %s does not match the number of KSUIDs %d", d, n)
+			}
+		})
+	}
+}
+
+func TestSplit(t *testing.T) {
+	t.Run("the key space is split in equal parts", func(t *testing.T) {
+		ids := Split(Nil, Max, 4)
+		expect := []KSUID{{0: 0x40}, {0: 0x80}, {0: 0xC0}}
+		testKSUIDs(t, expect, ids)
+	})
+
+	t.Run("parts differ by at most one KSUID", func(t *testing.T) {
+		lo := New()
+		hi := Add(lo, 1000)
+
+		for _, n := range []int{2, 3, 7, 1000, 1001, 2000} {
+			ids := Split(lo, hi, n)
+			if len(ids) != n-1 {
+				t.Fatalf("expected %d boundaries but got %d", n-1, len(ids))
+			}
+
+			bounds := append(append([]KSUID{lo}, ids...), hi.Next())
+			min, max := int64(math.MaxInt64), int64(0)
+
+			for i := 1; i < len(bounds); i++ {
+				d := Distance(bounds[i-1], bounds[i]).Int64()
+				if d < min {
+					min = d
+				}
+				if d > max {
+					max = d
+				}
+			}
+
+			if max-min > 1 {
+				t.Errorf("unbalanced split in %d parts: parts have between %d and %d KSUIDs", n, min, max)
+			}
+		}
+	})
+
+	t.Run("invalid arguments produce no boundaries", func(t *testing.T) {
+		id := New()
+
+		for _, ids := range [][]KSUID{
+			Split(Nil, Max, 1),
+			Split(Nil, Max, 0),
+			Split(id.Next(), id, 2),
+			SplitByTime(id.Time(), id.Time(), 2),
+			SplitByTime(time.Unix(0, 0), time.Unix(1, 0), 2),
+		} {
+			if ids != nil {
+				t.Errorf("expected no boundaries but got %v", ids)
+			}
+		}
+	})
+}
+
+func TestSplitByTime(t *testing.T) {
+	const n = 8
+	const count = 100000
+
+	from := New().Time()
+	to := from.Add(10 * time.Second)
+	ids := make([]KSUID, count)
+
+	for i := range ids {
+		ids[i], _ = NewRandomWithTime(from.Add(time.Duration(i) * (to.Sub(from) / count)))
+	}
+
+	Sort(ids)
+	bounds := SplitByTime(from, to, n)
+
+	// Times before the epoch of KSUIDs are clamped to it.
+	if b, e := SplitByTime(time.Unix(0, 0), to, n), Split(Nil, minKSUIDAt(to).Prev(), n); !reflect.DeepEqual(b, e) {
+		t.Errorf("bad boundaries from a time before the epoch: expected %v but got %v", e, b)
+	}
+
+	if len(bounds) != n-1 {
+		t.Fatalf("expected %d boundaries but got %d", n-1, len(bounds))
+	}
+
+	// The KSUIDs are spread uniformly over time, each part must hold about
+	// the same number of them.
+	prev := 0
+	for i := 0; i < n; i++ {
+		next := len(ids)
+		if i < len(bounds) {
+			next = Search(ids, bounds[i])
+		}
+
+		if size := next - prev; math.Abs(float64(size)-count/n) > 0.05*count/n {
+			t.Errorf("unbalanced part %d: %d KSUIDs instead of about %d", i, size, count/n)
+		}
+
+		prev = next
+	}
+}
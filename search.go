@@ -0,0 +1,86 @@
+package ksuid
+
+import (
+	"bytes"
+	"time"
+)
+
+// Search returns the index of the first KSUID of ids which is greater than or
+// equal to id, or len(ids) if there are none. The slice must be sorted, like
+// after a call to Sort.
+//
+// Like sort.Search, the returned index is where id would be inserted to keep
+// the slice sorted, and id is in the slice if the KSUID at that index is equal
+// to it.
+func Search(ids []KSUID, id KSUID) int {
+	return searchKSUID(ids, id, false)
+}
+
+// SearchTime returns the index of the first KSUID of ids which was generated at
+// or after t, or len(ids) if there are none. The slice must be sorted, like
+// after a call to Sort. Times out of the range of KSUID timestamps are clamped
+// to it.
+func SearchTime(ids []KSUID, t time.Time) int {
+	ts := timeToClampedTimestamp(t)
+	i, j := 0, len(ids)
+
+	for i < j {
+		h := int(uint(i+j) >> 1)
+		if ids[h].Timestamp() < ts {
+			i = h + 1
+		} else {
+			j = h
+		}
+	}
+
+	return i
+}
+
+// EqualRange returns the bounds of the sub-slice of ids holding KSUIDs equal to
+// id, which is empty if id is not in the slice. The slice must be sorted, like
+// after a call to Sort.
+func EqualRange(ids []KSUID, id KSUID) (i, j int) {
+	i = searchKSUID(ids, id, false)
+	j = i + searchKSUID(ids[i:], id, true)
+	return
+}
+
+// searchKSUID is the binary search used by Search and EqualRange, it returns
+// the index of the first KSUID greater than id if after is true, or greater
+// than or equal to id otherwise.
+//
+// The timestamp is compared as a single integer before falling back to a byte
+// comparison of the payload, which avoids the cost of bytes.Compare on KSUIDs
+// that were generated at different times.
+func searchKSUID(ids []KSUID, id KSUID, after bool) int {
+	ts := id.Timestamp()
+	payload := id[timestampLengthInBytes:]
+	i, j := 0, len(ids)
+
+	// The loop compares x with id and moves past x if it is lower, or equal
+	// when searching for the first KSUID after id.
+	c := 0
+	if after {
+		c = 1
+	}
+
+	for i < j {
+		h := int(uint(i+j) >> 1)
+		x := &ids[h]
+
+		less := false
+		if t := x.Timestamp(); t != ts {
+			less = t < ts
+		} else {
+			less = bytes.Compare(x[timestampLengthInBytes:], payload) < c
+		}
+
+		if less {
+			i = h + 1
+		} else {
+			j = h
+		}
+	}
+
+	return i
+}
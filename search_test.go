@@ -0,0 +1,93 @@
+package ksuid
+
+import (
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestSearch(t *testing.T) {
+	ids := makeSearchInput()
+
+	probes := []KSUID{Nil, Max, ids[0], ids[len(ids)-1], ids[0].Prev(), ids[len(ids)-1].Next()}
+	for i := 0; i < len(ids); i += 7 {
+		probes = append(probes, ids[i], ids[i].Prev(), ids[i].Next(), minKSUIDAt(ids[i].Time()))
+	}
+
+	for _, id := range probes {
+		i, j := EqualRange(ids, id)
+
+		lower := sort.Search(len(ids), func(i int) bool { return Compare(ids[i], id) >= 0 })
+		upper := sort.Search(len(ids), func(i int) bool { return Compare(ids[i], id) > 0 })
+
+		if n := Search(ids, id); n != lower {
+			t.Fatalf("bad index returned by Search(%s): expected %d but got %d", id, lower, n)
+		}
+		if i != lower || j != upper {
+			t.Fatalf("bad range returned by EqualRange(%s): expected [%d:%d] but got [%d:%d]", id, lower, upper, i, j)
+		}
+	}
+}
+
+func TestSearchTime(t *testing.T) {
+	ids := makeSearchInput()
+	now := ids[len(ids)/2].Time()
+
+	for _, at := range []time.Time{
+		time.Unix(0, 0),
+		time.Unix(epochStamp-1, 0),
+		time.Unix(epochStamp, 0),
+		now.Add(-time.Hour),
+		now.Add(-time.Second),
+		now,
+		now.Add(time.Second),
+		now.Add(time.Hour),
+		Max.Time(),
+		Max.Time().Add(time.Hour),
+	} {
+		expect := sort.Search(len(ids), func(i int) bool { return !ids[i].Time().Before(at) })
+
+		if i := SearchTime(ids, at); i != expect {
+			t.Errorf("bad index returned by SearchTime(%s): expected %d but got %d", at, expect, i)
+		}
+	}
+
+	if i := SearchTime(nil, now); i != 0 {
+		t.Errorf("bad index returned for an empty slice: %d", i)
+	}
+}
+
+// makeSearchInput returns a sorted slice of KSUIDs spread over a few seconds,
+// with duplicates.
+func makeSearchInput() []KSUID {
+	now := time.Now()
+	ids := []KSUID{}
+
+	for i := 0; i < 1000; i++ {
+		id, _ := NewRandomWithTime(now.Add(time.Duration(i%5-2) * time.Second))
+		ids = append(ids, id)
+		if i%3 == 0 {
+			ids = append(ids, id)
+		}
+	}
+
+	Sort(ids)
+	return ids
+}
+
+func BenchmarkSearch(b *testing.B) {
+	ids := makeSequences(10)
+	id := ids[len(ids)/3]
+
+	b.Run("Search", func(b *testing.B) {
+		for i := 0; i != b.N; i++ {
+			Search(ids, id)
+		}
+	})
+
+	b.Run("sort.Search", func(b *testing.B) {
+		for i := 0; i != b.N; i++ {
+			sort.Search(len(ids), func(i int) bool { return Compare(ids[i], id) >= 0 })
+		}
+	})
+}
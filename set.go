@@ -3,9 +3,19 @@ package ksuid
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
+	"math"
+	"math/bits"
+	"sort"
+	"time"
 )
 
 // CompressedSet is an immutable data type which stores a set of KSUIDs.
+//
+// Sets built by Compress or AppendCompressed in a single call hold their KSUIDs
+// in order. The methods which search or combine sets, like Contains, Range or
+// Union, rely on this order and give undefined results on sets which are not
+// sorted.
 type CompressedSet []byte
 
 // Iter returns an iterator that produces all KSUIDs in the set.
@@ -15,6 +25,92 @@ func (set CompressedSet) Iter() CompressedSetIter {
 	}
 }
 
+// Len returns the number of KSUIDs in the set.
+//
+// Contiguous ranges of KSUIDs are counted arithmetically rather than being
+// expanded, which makes Len much cheaper than iterating over the set. If the
+// set is malformed, Len returns the number of KSUIDs found before the error.
+// If the ranges hold more KSUIDs than an int can count, Len returns maxInt.
+func (set CompressedSet) Len() int {
+	n := 0
+	for it := set.Iter(); it.Next(); {
+		r := it.remaining()
+		if r > uint64(maxInt-n-1) {
+			return maxInt
+		}
+		n += 1 + int(r)
+		it.skipEntry()
+	}
+	return n
+}
+
+const maxInt = int(^uint(0) >> 1)
+
+// Contains returns true if id is part of the set.
+//
+// The search skips over contiguous ranges of KSUIDs without expanding them, and
+// stops as soon as it reaches KSUIDs greater than id.
+func (set CompressedSet) Contains(id KSUID) bool {
+	it := set.Iter()
+	return it.Seek(id) && it.KSUID == id
+}
+
+// MinKSUID returns the smallest KSUID of the set, or Nil if the set is empty.
+//
+// The smallest KSUID is the first one, it is returned without decoding the rest
+// of the set.
+func (set CompressedSet) MinKSUID() KSUID {
+	if it := set.Iter(); it.Next() {
+		return it.KSUID
+	}
+	return Nil
+}
+
+// MaxKSUID returns the largest KSUID of the set, or Nil if the set is empty.
+//
+// The method walks through the set to find its last KSUID, but does not expand
+// ranges of contiguous KSUIDs.
+func (set CompressedSet) MaxKSUID() KSUID {
+	it := set.Iter()
+	for it.Next() {
+		it.skipEntry()
+	}
+	return it.KSUID
+}
+
+// Range returns a new set containing the KSUIDs of set which are between min
+// and max, inclusively.
+//
+// Range walks the encoded form of the set up to min, then copies entries until
+// it reaches max, contiguous KSUIDs are carried over as ranges without being
+// decoded.
+func (set CompressedSet) Range(min, max KSUID) CompressedSet {
+	b := compressedSetBuilder{}
+	it := set.Iter()
+
+	for ok := it.Seek(min); ok && Compare(it.KSUID, max) <= 0; ok = it.Next() {
+		b.add(it.KSUID)
+
+		if it.seqlength != 0 && Compare(it.rangeEnd().ksuid(it.timestamp), max) <= 0 {
+			b.extendRange(it.seqlength)
+			it.skipEntry()
+		}
+	}
+
+	return b.compressedSet()
+}
+
+// Between returns a new set containing the KSUIDs of set which were generated
+// at or after from, and before to. Times are truncated to the second, which is
+// the resolution of KSUID timestamps.
+func (set CompressedSet) Between(from, to time.Time) CompressedSet {
+	min, max := minKSUIDAt(from), minKSUIDAt(to)
+	if Compare(min, max) >= 0 {
+		return CompressedSet{}
+	}
+	return set.Range(min, max.Prev())
+}
+
 // String satisfies the fmt.Stringer interface, returns a human-readable string
 // representation of the set.
 func (set CompressedSet) String() string {
@@ -64,99 +160,310 @@ func Compress(ids ...KSUID) CompressedSet {
 // resuling length is not 20 x len(ids). The rule of thumb here is for the given
 // byte slice to reserve the amount of memory that the application would be OK
 // to waste.
+//
+// If ids are not sorted they are sorted in place, programs that need to build
+// sets without holding all KSUIDs in memory or modifying them should use a
+// CompressedSetWriter instead.
 func AppendCompressed(set []byte, ids ...KSUID) CompressedSet {
 	if len(ids) != 0 {
 		if !IsSorted(ids) {
 			Sort(ids)
 		}
-		one := makeUint128(0, 1)
+		b := compressedSetBuilder{set: set}
+		for _, id := range ids {
+			b.add(id)
+		}
+		set = b.compressedSet()
+	}
+	return CompressedSet(set)
+}
+
+// Union returns a new set containing the KSUIDs that are in either set or
+// other.
+//
+// The two sets are merged entry by entry without ever materializing their
+// content as slices of KSUIDs.
+func (set CompressedSet) Union(other CompressedSet) CompressedSet {
+	return combineCompressedSets(set, other, len(set)+len(other), true, true, true)
+}
 
+// Intersect returns a new set containing the KSUIDs that are in both set and
+// other.
+func (set CompressedSet) Intersect(other CompressedSet) CompressedSet {
+	return combineCompressedSets(set, other, minInt(len(set), len(other)), false, false, true)
+}
+
+// Difference returns a new set containing the KSUIDs that are in set but not
+// in other.
+func (set CompressedSet) Difference(other CompressedSet) CompressedSet {
+	return combineCompressedSets(set, other, len(set), true, false, false)
+}
+
+// SymmetricDifference returns a new set containing the KSUIDs that are in
+// exactly one of set and other.
+func (set CompressedSet) SymmetricDifference(other CompressedSet) CompressedSet {
+	return combineCompressedSets(set, other, len(set)+len(other), true, true, false)
+}
+
+// combineCompressedSets merges the sorted sequences of KSUIDs produced by a and
+// b, keeping ids found only in a, only in b, or in both depending on the flags.
+func combineCompressedSets(a, b CompressedSet, capacity int, onlyA, onlyB, both bool) CompressedSet {
+	c := compressedSetBuilder{set: make([]byte, 0, capacity)}
+
+	itA, itB := a.Iter(), b.Iter()
+	okA, okB := itA.Next(), itB.Next()
+
+	for okA && okB {
+		switch cmp := Compare(itA.KSUID, itB.KSUID); {
+		case cmp < 0:
+			if onlyA {
+				c.add(itA.KSUID)
+			}
+			okA = itA.Next()
+		case cmp > 0:
+			if onlyB {
+				c.add(itB.KSUID)
+			}
+			okB = itB.Next()
+		default:
+			if both {
+				c.add(itA.KSUID)
+			}
+			okA, okB = itA.Next(), itB.Next()
+		}
+	}
+
+	for ; okA && onlyA; okA = itA.Next() {
+		c.add(itA.KSUID)
+	}
+
+	for ; okB && onlyB; okB = itB.Next() {
+		c.add(itB.KSUID)
+	}
+
+	return c.compressedSet()
+}
+
+// compressedSetBuilder incrementally encodes a sorted sequence of KSUIDs. It
+// produces the same encoding as AppendCompressed, but does not need to see the
+// whole list of ids upfront: contiguous ids are accumulated in a pending range
+// which is only written when the range is broken or the builder is flushed.
+//
+// KSUIDs which only differ by their last two bytes, like those generated by a
+// Sequence, form a group. The group is first encoded with deltas and ranges,
+// and is re-encoded as a bitmap when it ends if the bitmap is smaller.
+type compressedSetBuilder struct {
+	set []byte
+
+	started   bool
+	seqlength uint64
+	timestamp uint32
+	lastKSUID KSUID
+	lastValue uint128
+
+	noBitmaps  bool // used to compare the encodings in tests and benchmarks
+	groupStart int
+	groupLen   int
+	groupMin   uint16
+	groupMax   uint16
+	bitmap     []byte
+}
+
+func (b *compressedSetBuilder) add(id KSUID) {
+	if b.started && id == b.lastKSUID {
+		return
+	}
+
+	n := sequenceNumber(id)
+
+	if b.groupLen == 0 || n < b.groupMax || !hasBitmapPrefix(id, b.lastKSUID) {
+		b.closeGroup()
+		b.groupStart = len(b.set)
+		b.groupMin = n
+	}
+
+	b.addToGroup(n)
+
+	if !b.started {
 		// The first KSUID is always written to the set, this is the starting
 		// point for all deltas.
-		set = append(set, byte(rawKSUID))
-		set = append(set, ids[0][:]...)
+		b.set = append(b.set, byte(rawKSUID))
+		b.set = append(b.set, id[:]...)
+		b.started = true
+		b.timestamp = id.Timestamp()
+		b.lastKSUID = id
+		b.lastValue = uint128Payload(id)
+		return
+	}
 
-		timestamp := ids[0].Timestamp()
-		lastKSUID := ids[0]
-		lastValue := uint128Payload(ids[0])
+	t := id.Timestamp()
+	v := uint128Payload(id)
 
-		for i := 1; i != len(ids); i++ {
-			id := ids[i]
+	if t != b.timestamp {
+		b.flushRange()
 
-			if id == lastKSUID {
-				continue
-			}
+		d := t - b.timestamp
+		n := varintLength32(d)
 
-			t := id.Timestamp()
-			v := uint128Payload(id)
+		b.set = append(b.set, timeDelta|byte(n))
+		b.set = appendVarint32(b.set, d, n)
+		b.set = append(b.set, id[timestampLengthInBytes:]...)
 
-			if t != timestamp {
-				d := t - timestamp
-				n := varintLength32(d)
+		b.timestamp = t
+	} else if d := sub128(v, b.lastValue); d != makeUint128(0, 1) {
+		b.flushRange()
 
-				set = append(set, timeDelta|byte(n))
-				set = appendVarint32(set, d, n)
-				set = append(set, id[timestampLengthInBytes:]...)
+		n := varintLength128(d)
 
-				timestamp = t
-			} else {
-				d := sub128(v, lastValue)
+		b.set = append(b.set, payloadDelta|byte(n))
+		b.set = appendVarint128(b.set, d, n)
+	} else {
+		b.seqlength++
+	}
 
-				if d != one {
-					n := varintLength128(d)
+	b.lastKSUID = id
+	b.lastValue = v
+}
 
-					set = append(set, payloadDelta|byte(n))
-					set = appendVarint128(set, d, n)
-				} else {
-					l, c := rangeLength(ids[i+1:], t, id, v)
-					m := uint64(l + 1)
-					n := varintLength64(m)
+func (b *compressedSetBuilder) flushRange() {
+	if b.seqlength != 0 {
+		n := varintLength64(b.seqlength)
 
-					set = append(set, payloadRange|byte(n))
-					set = appendVarint64(set, m, n)
+		b.set = append(b.set, payloadRange|byte(n))
+		b.set = appendVarint64(b.set, b.seqlength, n)
 
-					i += c
-					id = ids[i]
-					v = uint128Payload(id)
-				}
-			}
+		b.seqlength = 0
+	}
+}
 
-			lastKSUID = id
-			lastValue = v
-		}
+// extendRange adds the n KSUIDs which follow the last KSUID added to the
+// builder, in constant time.
+//
+// When the KSUIDs share the bitmap prefix of the current group, they are added
+// to the group in bulk so it is re-encoded as a bitmap exactly like when they
+// are passed to add. Otherwise the group ends before them, and they are only
+// appended to the pending range.
+func (b *compressedSetBuilder) extendRange(n uint64) {
+	if n <= uint64(math.MaxUint16-b.groupMax) {
+		b.addRunToGroup(b.groupMax+1, uint16(n))
+	} else {
+		b.endGroup()
 	}
-	return CompressedSet(set)
+
+	b.seqlength += n
+	b.lastValue = add128(b.lastValue, makeUint128(0, n))
+	b.lastKSUID = b.lastValue.ksuid(b.timestamp)
 }
 
-func rangeLength(ids []KSUID, timestamp uint32, lastKSUID KSUID, lastValue uint128) (length int, count int) {
-	one := makeUint128(0, 1)
+// addRunToGroup adds the n contiguous sequence numbers starting at first to
+// the current group, which must not be empty.
+func (b *compressedSetBuilder) addRunToGroup(first uint16, n uint16) {
+	if n == 0 {
+		return
+	}
+
+	b.groupLen += int(n)
+	b.groupMax = first + n - 1
+
+	if !b.noBitmaps {
+		if b.bitmap == nil {
+			b.bitmap = make([]byte, bitmapMaxLength)
+		}
+		b.bitmap[0] |= 1 // the group has at least two KSUIDs
+
+		i, j := int(first-b.groupMin), int(b.groupMax-b.groupMin)
+		for ; i <= j && i%8 != 0; i++ {
+			b.bitmap[i/8] |= 1 << uint(i%8)
+		}
+		for ; i+7 <= j; i += 8 {
+			b.bitmap[i/8] = 0xFF
+		}
+		for ; i <= j; i++ {
+			b.bitmap[i/8] |= 1 << uint(i%8)
+		}
+	}
+}
 
-	for i := range ids {
-		id := ids[i]
+func (b *compressedSetBuilder) addToGroup(n uint16) {
+	b.groupLen++
+	b.groupMax = n
 
-		if id == lastKSUID {
-			continue
+	if b.groupLen > 1 && !b.noBitmaps {
+		if b.bitmap == nil {
+			b.bitmap = make([]byte, bitmapMaxLength)
+		}
+		if b.groupLen == 2 {
+			b.bitmap[0] |= 1
 		}
+		i := n - b.groupMin
+		b.bitmap[i/8] |= 1 << (i % 8)
+	}
+}
 
-		if id.Timestamp() != timestamp {
-			count = i
-			return
+// closeGroup ends the current group of KSUIDs, rewriting it as a bitmap if it
+// takes less space than the entries that it was encoded with.
+func (b *compressedSetBuilder) closeGroup() {
+	b.endGroup()
+	b.flushRange()
+}
+
+// endGroup re-encodes the current group as a bitmap if it is smaller, and
+// starts a new group. Unless the group was re-encoded, the pending range is
+// left open.
+func (b *compressedSetBuilder) endGroup() {
+	if b.groupLen > 1 && !b.noBitmaps {
+		n := int(b.groupMax-b.groupMin)/8 + 1
+		size := len(b.set) - b.groupStart
+
+		if b.seqlength != 0 {
+			size += 1 + varintLength64(b.seqlength)
 		}
 
-		v := uint128Payload(id)
+		if (1 + bitmapHeaderLength + n) < size {
+			b.set = b.set[:b.groupStart]
+			b.set = append(b.set, payloadBitmap)
+			b.set = append(b.set, b.lastKSUID[:bitmapPrefixLength]...)
+			b.set = appendUint16(b.set, b.groupMin)
+			b.set = appendUint16(b.set, uint16(n))
+			b.set = append(b.set, b.bitmap[:n]...)
+			b.seqlength = 0
+		}
 
-		if sub128(v, lastValue) != one {
-			count = i
-			return
+		for i := range b.bitmap[:n] {
+			b.bitmap[i] = 0
 		}
+	}
 
-		lastKSUID = id
-		lastValue = v
-		length++
+	b.groupLen = 0
+}
+
+// compressedSet flushes any pending range or group and returns the set built
+// so far.
+func (b *compressedSetBuilder) compressedSet() CompressedSet {
+	b.closeGroup()
+	return CompressedSet(b.set)
+}
+
+// hasBitmapPrefix returns true if a and b can be stored in the same bitmap.
+func hasBitmapPrefix(a, b KSUID) bool {
+	return bytes.Equal(a[:bitmapPrefixLength], b[:bitmapPrefixLength])
+}
+
+// sequenceNumber returns the last two bytes of id, which are the bytes set by
+// a Sequence and indexed by bitmaps.
+func sequenceNumber(id KSUID) uint16 {
+	return binary.BigEndian.Uint16(id[bitmapPrefixLength:])
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
 	}
+	return b
+}
 
-	count = len(ids)
-	return
+func appendUint16(b []byte, v uint16) []byte {
+	return append(b, byte(v>>8), byte(v))
 }
 
 func appendVarint128(b []byte, v uint128, n int) []byte {
@@ -240,8 +547,61 @@ const (
 	timeDelta    = (1 << 6)
 	payloadDelta = (1 << 7)
 	payloadRange = (1 << 6) | (1 << 7)
+
+	// Bitmaps use the tag of raw KSUIDs, they are told apart by their length
+	// bits which are always zero for raw KSUIDs.
+	payloadBitmap = rawKSUID | 1
 )
 
+// Bitmap entries start with the 18 bytes prefix shared by all their KSUIDs,
+// followed by the uint16 BE sequence number of the first KSUID, and the uint16
+// BE length of the bitmap in bytes. In the bitmap that comes next, the bit i
+// (bit i%8 of byte i/8) is set if the KSUID with the sequence number of the
+// first KSUID plus i is part of the set.
+const (
+	bitmapPrefixLength = byteLength - 2
+	bitmapHeaderLength = bitmapPrefixLength + 4
+	bitmapMaxLength    = (math.MaxUint16 + 1) / 8
+)
+
+// maxEntryLength is the size of the largest fixed-length entries of a
+// compressed set, raw KSUIDs and time deltas with a 4 bytes varint, including
+// the tag byte.
+const maxEntryLength = 1 + byteLength
+
+// entryLength returns the number of bytes that follow the tag byte b in an
+// entry of a compressed set, or an error if b is not a valid tag. For bitmaps,
+// the length of the bitmap itself is not included.
+func entryLength(b byte) (int, error) {
+	const mask = rawKSUID | timeDelta | payloadDelta | payloadRange
+	tag := int(b) & mask
+	cnt := int(b) & ^mask
+
+	switch tag {
+	case rawKSUID:
+		switch cnt {
+		case 0:
+			return byteLength, nil
+		case payloadBitmap:
+			return bitmapHeaderLength, nil
+		}
+	case timeDelta:
+		if cnt != 0 && cnt <= timestampLengthInBytes {
+			return cnt + payloadLengthInBytes, nil
+		}
+	case payloadDelta:
+		if cnt != 0 && cnt <= payloadLengthInBytes {
+			return cnt, nil
+		}
+	case payloadRange:
+		if cnt != 0 && cnt <= 8 {
+			return cnt, nil
+		}
+	}
+
+	return 0, errSetMalformed
+}
+
 // CompressedSetIter is an iterator type returned by Set.Iter to produce the
 // list of KSUIDs stored in a set.
 //
@@ -261,14 +621,24 @@ type CompressedSetIter struct {
 
 	content []byte
 	offset  int
+	index   []compressedSetCheckpoint
 
 	seqlength uint64
 	timestamp uint32
 	lastValue uint128
+
+	bitmap   []byte
+	bitIndex int
+	bitFirst uint16
+
+	err error
 }
 
 // Next moves the iterator forward, returning true if there a KSUID was found,
 // or false if the iterator as reached the end of the set it was created from.
+//
+// Next also returns false if the set is malformed, in which case the Err method
+// reports what was wrong with the data.
 func (it *CompressedSetIter) Next() bool {
 	if it.seqlength != 0 {
 		value := incr128(it.lastValue)
@@ -278,19 +648,39 @@ func (it *CompressedSetIter) Next() bool {
 		return true
 	}
 
-	if it.offset == len(it.content) {
+	if it.bitmap != nil {
+		if i := nextBit(it.bitmap, it.bitIndex+1); i >= 0 {
+			it.moveToBit(i)
+			return true
+		}
+		it.bitmap = nil
+	}
+
+	if it.offset == len(it.content) || it.err != nil {
 		return false
 	}
 
 	b := it.content[it.offset]
 	it.offset++
 
+	n, err := entryLength(b)
+	if err != nil {
+		return it.fail(err)
+	}
+	if it.offset+n > len(it.content) {
+		return it.fail(errSetTruncated)
+	}
+
 	const mask = rawKSUID | timeDelta | payloadDelta | payloadRange
 	tag := int(b) & mask
 	cnt := int(b) & ^mask
 
 	switch tag {
 	case rawKSUID:
+		if cnt == payloadBitmap {
+			return it.loadBitmap()
+		}
+
 		off0 := it.offset
 		off1 := off0 + byteLength
 
@@ -305,7 +695,12 @@ func (it *CompressedSetIter) Next() bool {
 		off1 := off0 + cnt
 		off2 := off1 + payloadLengthInBytes
 
-		it.timestamp += varint32(it.content[off0:off1])
+		timestamp := it.timestamp + varint32(it.content[off0:off1])
+		if timestamp < it.timestamp {
+			return it.fail(errSetMalformed)
+		}
+
+		it.timestamp = timestamp
 
 		binary.BigEndian.PutUint32(it.KSUID[:timestampLengthInBytes], it.timestamp)
 		copy(it.KSUID[timestampLengthInBytes:], it.content[off1:off2])
@@ -319,6 +714,9 @@ func (it *CompressedSetIter) Next() bool {
 
 		delta := varint128(it.content[off0:off1])
 		value := add128(it.lastValue, delta)
+		if cmp128(value, it.lastValue) < 0 {
+			return it.fail(errSetMalformed)
+		}
 
 		it.KSUID = value.ksuid(it.timestamp)
 		it.offset = off1
@@ -328,16 +726,437 @@ func (it *CompressedSetIter) Next() bool {
 		off0 := it.offset
 		off1 := off0 + cnt
 
+		seqlength := varint64(it.content[off0:off1])
+		if seqlength == 0 {
+			return it.fail(errSetMalformed)
+		}
+		if end := add128(it.lastValue, makeUint128(0, seqlength)); cmp128(end, it.lastValue) <= 0 {
+			// The range goes past the last payload.
+			return it.fail(errSetMalformed)
+		}
+
 		value := incr128(it.lastValue)
 		it.KSUID = value.ksuid(it.timestamp)
-		it.seqlength = varint64(it.content[off0:off1])
+		it.seqlength = seqlength - 1
 		it.offset = off1
-		it.seqlength--
 		it.lastValue = value
+	}
 
-	default:
-		panic("KSUID set iterator is reading malformed data")
+	return true
+}
+
+func (it *CompressedSetIter) loadBitmap() bool {
+	off0 := it.offset
+	off1 := off0 + bitmapPrefixLength
+	off2 := off0 + bitmapHeaderLength
+
+	first := binary.BigEndian.Uint16(it.content[off1:])
+	n := int(binary.BigEndian.Uint16(it.content[off1+2:]))
+	off3 := off2 + n
+
+	if n == 0 || n > bitmapMaxLength {
+		return it.fail(errSetMalformed)
+	}
+	if off3 > len(it.content) {
+		return it.fail(errSetTruncated)
+	}
+
+	// The first bit is always set since it represents the first KSUID, and
+	// bitmaps are never padded with zero bytes.
+	bitmap := it.content[off2:off3]
+	if (bitmap[0]&1) == 0 || bitmap[n-1] == 0 || int(first)+lastBit(bitmap) > math.MaxUint16 {
+		return it.fail(errSetMalformed)
+	}
+
+	copy(it.KSUID[:bitmapPrefixLength], it.content[off0:off1])
+
+	it.offset = off3
+	it.timestamp = it.KSUID.Timestamp()
+	it.bitmap = bitmap
+	it.bitFirst = first
+	it.moveToBit(0)
+	return true
+}
+
+func (it *CompressedSetIter) moveToBit(i int) {
+	it.bitIndex = i
+	binary.BigEndian.PutUint16(it.KSUID[bitmapPrefixLength:], it.bitFirst+uint16(i))
+	it.lastValue = uint128Payload(it.KSUID)
+}
+
+// nextBit returns the index of the first bit set at or after i in bitmap, or
+// -1 if there are none.
+func nextBit(bitmap []byte, i int) int {
+	for j := i / 8; j < len(bitmap); j++ {
+		c := bitmap[j]
+		if j == i/8 {
+			c &= 0xFF << uint(i%8)
+		}
+		if c != 0 {
+			return 8*j + bits.TrailingZeros8(c)
+		}
+	}
+	return -1
+}
+
+// lastBit returns the index of the last bit set in bitmap, which must not end
+// with a zero byte.
+func lastBit(bitmap []byte) int {
+	return 8*len(bitmap) - 1 - bits.LeadingZeros8(bitmap[len(bitmap)-1])
+}
+
+// countBits returns the number of bits set after the bit i in bitmap.
+func countBits(bitmap []byte, i int) int {
+	n := bits.OnesCount8(bitmap[i/8] &^ (0xFF >> uint(7-i%8)))
+	for _, c := range bitmap[i/8+1:] {
+		n += bits.OnesCount8(c)
+	}
+	return n
+}
+
+// ID returns the KSUID that the iterator is positioned on.
+func (it *CompressedSetIter) ID() KSUID {
+	return it.KSUID
+}
+
+// Err returns the error that caused the iterator to stop, or nil if it reached
+// the end of the set, or has not stopped yet.
+func (it *CompressedSetIter) Err() error {
+	return it.err
+}
+
+func (it *CompressedSetIter) fail(err error) bool {
+	it.offset-- // point at the entry that could not be decoded
+	it.err = err
+	return false
+}
+
+// ValidateCompressedSet checks that b holds a well-formed compressed set,
+// returning an error describing the first problem found if it does not.
+//
+// The validation walks through the whole set, but does not expand ranges of
+// contiguous KSUIDs, so the cost is proportional to the size of the set in
+// bytes. Sets that come from untrusted sources like the network or disk should
+// be validated before being used, or the Err method of their iterators should
+// be checked.
+func ValidateCompressedSet(b []byte) error {
+	it := CompressedSet(b).Iter()
+	for it.Next() {
+		it.skipEntry()
+	}
+	return it.Err()
+}
+
+var (
+	errSetMalformed = errors.New("malformed KSUID set")
+	errSetTruncated = errors.New("truncated KSUID set")
+)
+
+// rangeEnd returns the payload of the last KSUID of the range that the iterator
+// is currently positioned in.
+func (it *CompressedSetIter) rangeEnd() uint128 {
+	return add128(it.lastValue, makeUint128(0, it.seqlength))
+}
+
+// inEntry returns true if the iterator is positioned in a range or a bitmap
+// which has more KSUIDs to produce.
+func (it *CompressedSetIter) inEntry() bool {
+	return it.seqlength != 0 || (it.bitmap != nil && it.bitIndex != lastBit(it.bitmap))
+}
+
+// remaining returns the number of KSUIDs left in the range or bitmap that the
+// iterator is positioned in.
+func (it *CompressedSetIter) remaining() uint64 {
+	if it.bitmap != nil {
+		return uint64(countBits(it.bitmap, it.bitIndex))
+	}
+	return it.seqlength
+}
+
+// skipEntry moves the iterator to the last KSUID of the range or bitmap it is
+// currently positioned in, without producing the intermediary KSUIDs. The
+// method does nothing if the iterator is not positioned in a range or bitmap.
+func (it *CompressedSetIter) skipEntry() {
+	switch {
+	case it.seqlength != 0:
+		it.lastValue = it.rangeEnd()
+		it.KSUID = it.lastValue.ksuid(it.timestamp)
+		it.seqlength = 0
+	case it.bitmap != nil:
+		it.moveToBit(lastBit(it.bitmap))
+	}
+}
+
+// seekEntry moves the iterator to the first KSUID greater or equal to id in the
+// range or bitmap it is positioned in, returning false if there are no such
+// KSUIDs. The current KSUID of the iterator must be lower than id.
+func (it *CompressedSetIter) seekEntry(id KSUID) bool {
+	if !it.inEntry() {
+		return false
+	}
+
+	if it.bitmap != nil {
+		last := it.KSUID
+		binary.BigEndian.PutUint16(last[bitmapPrefixLength:], it.bitFirst+uint16(lastBit(it.bitmap)))
+
+		if Compare(id, last) > 0 {
+			return false
+		}
+
+		// id is between two KSUIDs of the bitmap, so it shares their prefix.
+		it.moveToBit(nextBit(it.bitmap, int(sequenceNumber(id)-it.bitFirst)))
+		return true
+	}
+
+	if id.Timestamp() != it.timestamp || cmp128(uint128Payload(id), it.rangeEnd()) > 0 {
+		return false
 	}
 
+	v := uint128Payload(id)
+	it.seqlength -= sub128(v, it.lastValue)[0]
+	it.lastValue = v
+	it.KSUID = id
 	return true
 }
+
+// Seek positions the iterator on the first KSUID of the set which is greater or
+// equal to id, returning false if there are no such KSUIDs. Calls to Next made
+// after Seek continue from the position that the iterator was moved to.
+//
+// When seeking forward from the current position the iterator resumes from
+// where it is, otherwise the search starts over from the beginning of the set.
+// Iterators created by IndexedCompressedSet.Iter use the index to skip most of
+// the set instead of decoding it linearly.
+func (it *CompressedSetIter) Seek(id KSUID) bool {
+	if it.offset != 0 {
+		switch cmp := Compare(it.KSUID, id); {
+		case cmp == 0:
+			return true
+		case cmp > 0:
+			it.reset()
+		}
+	}
+
+	if i := searchCheckpoints(it.index, id) - 1; i >= 0 && it.index[i].offset > it.offset {
+		it.restore(it.index[i])
+	}
+
+	for {
+		if it.seekEntry(id) {
+			return true
+		}
+
+		it.skipEntry()
+
+		if !it.Next() {
+			return false
+		}
+
+		if Compare(it.KSUID, id) >= 0 {
+			return true
+		}
+	}
+}
+
+// SeekTime positions the iterator on the first KSUID of the set which was
+// generated at or after t, returning false if there are no such KSUIDs.
+func (it *CompressedSetIter) SeekTime(t time.Time) bool {
+	return it.Seek(minKSUIDAt(t))
+}
+
+func (it *CompressedSetIter) reset() {
+	it.KSUID = Nil
+	it.offset = 0
+	it.seqlength = 0
+	it.timestamp = 0
+	it.lastValue = uint128{}
+	it.bitmap = nil
+	it.err = nil
+}
+
+func (it *CompressedSetIter) restore(cp compressedSetCheckpoint) {
+	it.KSUID = cp.ksuid
+	it.offset = cp.offset
+	it.seqlength = 0
+	it.timestamp = cp.ksuid.Timestamp()
+	it.lastValue = uint128Payload(cp.ksuid)
+	it.bitmap = nil
+}
+
+// minKSUIDAt returns the smallest KSUID that can be generated at time t. Times
+// out of the range of KSUID timestamps are clamped to it.
+func minKSUIDAt(t time.Time) KSUID {
+	var id KSUID
+	binary.BigEndian.PutUint32(id[:timestampLengthInBytes], timeToClampedTimestamp(t))
+	return id
+}
+
+// IndexedCompressedSet pairs a CompressedSet with a sparse index which allows
+// iterators to seek to arbitrary KSUIDs or times in logarithmic time.
+//
+// KSUIDs in a compressed set are delta-encoded from their predecessor, so
+// finding a KSUID normally requires decoding the set from the start. The index
+// records a checkpoint holding the absolute value of a KSUID and the byte
+// offset of the entry that follows it every few entries, which is enough to
+// resume decoding from the middle of the set.
+type IndexedCompressedSet struct {
+	set         CompressedSet
+	interval    int
+	checkpoints []compressedSetCheckpoint
+}
+
+type compressedSetCheckpoint struct {
+	ksuid  KSUID
+	offset int
+}
+
+// DefaultIndexInterval is the number of entries between checkpoints of the
+// index built by NewIndexedCompressedSet when no interval is given.
+const DefaultIndexInterval = 64
+
+// NewIndexedCompressedSet builds an index over set, recording a checkpoint
+// every interval entries. Smaller intervals make seeking faster at the cost of
+// a larger index. If interval is zero or negative, DefaultIndexInterval is used.
+func NewIndexedCompressedSet(set CompressedSet, interval int) *IndexedCompressedSet {
+	if interval <= 0 {
+		interval = DefaultIndexInterval
+	}
+
+	index := &IndexedCompressedSet{
+		set:      set,
+		interval: interval,
+	}
+
+	for i, it := 1, set.Iter(); it.Next(); i++ {
+		it.skipEntry()
+
+		if (i%interval) == 0 && it.offset != len(set) {
+			index.checkpoints = append(index.checkpoints, compressedSetCheckpoint{
+				ksuid:  it.KSUID,
+				offset: it.offset,
+			})
+		}
+	}
+
+	return index
+}
+
+// Set returns the compressed set that the index was built for.
+func (set *IndexedCompressedSet) Set() CompressedSet {
+	return set.set
+}
+
+// Iter returns an iterator that produces all KSUIDs in the set, and uses the
+// index when its Seek or SeekTime methods are called.
+func (set *IndexedCompressedSet) Iter() CompressedSetIter {
+	return CompressedSetIter{
+		content: []byte(set.set),
+		index:   set.checkpoints,
+	}
+}
+
+// Contains returns true if id is part of the set, using the index to skip to
+// the region of the set where id would be.
+func (set *IndexedCompressedSet) Contains(id KSUID) bool {
+	it := set.Iter()
+	return it.Seek(id) && it.KSUID == id
+}
+
+// MarshalBinary satisfies the encoding.BinaryMarshaler interface. The index is
+// serialized ahead of the compressed set so it does not need to be rebuilt
+// when the value is loaded back, UnmarshalBinary only verifies it against the
+// set.
+func (set *IndexedCompressedSet) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 0, 2*binary.MaxVarintLen64+len(set.checkpoints)*(byteLength+4)+len(set.set))
+	b = appendUvarint(b, uint64(set.interval))
+	b = appendUvarint(b, uint64(len(set.checkpoints)))
+
+	for _, cp := range set.checkpoints {
+		b = append(b, cp.ksuid[:]...)
+		b = appendUvarint(b, uint64(cp.offset))
+	}
+
+	return append(b, set.set...), nil
+}
+
+// UnmarshalBinary satisfies the encoding.BinaryUnmarshaler interface.
+func (set *IndexedCompressedSet) UnmarshalBinary(b []byte) error {
+	interval, n := binary.Uvarint(b)
+	if n <= 0 || interval == 0 {
+		return errIndexedSetMalformed
+	}
+	b = b[n:]
+
+	count, n := binary.Uvarint(b)
+	if n <= 0 || count > uint64(len(b)/(byteLength+1)) {
+		return errIndexedSetMalformed
+	}
+	b = b[n:]
+
+	checkpoints := make([]compressedSetCheckpoint, count)
+
+	for i := range checkpoints {
+		if len(b) < byteLength {
+			return errIndexedSetMalformed
+		}
+		copy(checkpoints[i].ksuid[:], b)
+		b = b[byteLength:]
+
+		offset, n := binary.Uvarint(b)
+		if n <= 0 {
+			return errIndexedSetMalformed
+		}
+		b = b[n:]
+		checkpoints[i].offset = int(offset)
+	}
+
+	// Offsets are validated once the length of the set is known, they must
+	// be strictly increasing and point inside the set.
+	for i, cp := range checkpoints {
+		if cp.offset <= 0 || cp.offset >= len(b) || (i != 0 && cp.offset <= checkpoints[i-1].offset) {
+			return errIndexedSetMalformed
+		}
+	}
+
+	// Iterators resume decoding from the checkpoints, which must be on entry
+	// boundaries and hold the KSUID that the entry before them ends with, or
+	// seeking would silently return wrong results.
+	i := 0
+	for it := CompressedSet(b).Iter(); i != len(checkpoints) && it.Next(); {
+		it.skipEntry()
+
+		switch cp := checkpoints[i]; {
+		case it.offset == cp.offset && it.KSUID == cp.ksuid:
+			i++
+		case it.offset >= cp.offset:
+			return errIndexedSetMalformed
+		}
+	}
+
+	if i != len(checkpoints) {
+		return errIndexedSetMalformed
+	}
+
+	*set = IndexedCompressedSet{
+		set:         CompressedSet(append([]byte{}, b...)),
+		interval:    int(interval),
+		checkpoints: checkpoints,
+	}
+	return nil
+}
+
+var errIndexedSetMalformed = errors.New("malformed indexed KSUID set")
+
+// searchCheckpoints returns the index of the first checkpoint holding a KSUID
+// greater or equal to id.
+func searchCheckpoints(checkpoints []compressedSetCheckpoint, id KSUID) int {
+	return sort.Search(len(checkpoints), func(i int) bool {
+		return Compare(checkpoints[i].ksuid, id) >= 0
+	})
+}
+
+func appendUvarint(b []byte, v uint64) []byte {
+	c := [binary.MaxVarintLen64]byte{}
+	n := binary.PutUvarint(c[:], v)
+	return append(b, c[:n]...)
+}
@@ -0,0 +1,159 @@
+package ksuid
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+)
+
+// Compressed sets can be serialized in a self-describing container format,
+// which carries a version number to allow the encoding to evolve, a summary of
+// the content of the set, and a checksum to detect corruption:
+//
+//	00-03 byte: magic "KSET"
+//	04-04 byte: format version (1, or 2 if the set contains bitmaps)
+//	05-12 byte: uint64 BE number of KSUIDs in the set
+//	13-32 byte: minimum KSUID of the set
+//	33-52 byte: maximum KSUID of the set
+//	53-N  byte: compressed set
+//	N-N+4 byte: uint32 BE CRC-32C of all the preceding bytes
+//
+// The first byte of the magic sequence is not a valid tag for the first entry
+// of a compressed set, so containers can be told apart from the headerless
+// sets produced by Compress.
+const (
+	containerMagic   = "KSET"
+	containerVersion = 2
+
+	containerHeaderLength  = len(containerMagic) + 1 + 8 + (2 * byteLength)
+	containerTrailerLength = 4
+)
+
+var (
+	crc32c = crc32.MakeTable(crc32.Castagnoli)
+
+	errSetChecksum = errors.New("KSUID set checksum mismatch")
+	errSetVersion  = errors.New("unsupported KSUID set format version")
+)
+
+// MarshalBinary satisfies the encoding.BinaryMarshaler interface, it returns
+// the set serialized in the container format. An error is returned if the set
+// is malformed.
+func (set CompressedSet) MarshalBinary() ([]byte, error) {
+	stats, err := set.stats()
+	if err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, 0, containerHeaderLength+len(set)+containerTrailerLength)
+	b = append(b, containerMagic...)
+	b = append(b, stats.version())
+	b = appendUint64(b, stats.count)
+	b = append(b, stats.min[:]...)
+	b = append(b, stats.max[:]...)
+	b = append(b, set...)
+	b = appendUint32(b, crc32Checksum(b))
+	return b, nil
+}
+
+// UnmarshalBinary satisfies the encoding.BinaryUnmarshaler interface. It
+// accepts both sets serialized in the container format and the raw bytes of
+// sets built by Compress or AppendCompressed, and returns an error if the data
+// is corrupted or malformed.
+func (set *CompressedSet) UnmarshalBinary(b []byte) error {
+	if len(b) < len(containerMagic) || string(b[:len(containerMagic)]) != containerMagic {
+		if err := ValidateCompressedSet(b); err != nil {
+			return err
+		}
+		*set = append((*set)[:0], b...)
+		return nil
+	}
+
+	if len(b) < containerHeaderLength+containerTrailerLength {
+		return errSetTruncated
+	}
+
+	version := b[len(containerMagic)]
+	if version == 0 || version > containerVersion {
+		return errSetVersion
+	}
+
+	n := len(b) - containerTrailerLength
+	if binary.BigEndian.Uint32(b[n:]) != crc32Checksum(b[:n]) {
+		return errSetChecksum
+	}
+
+	content := CompressedSet(b[containerHeaderLength:n])
+
+	stats, err := content.stats()
+	if err != nil {
+		return err
+	}
+
+	header := b[len(containerMagic)+1:]
+	if version < stats.version() || stats.count != binary.BigEndian.Uint64(header) ||
+		string(stats.min[:]) != string(header[8:8+byteLength]) ||
+		string(stats.max[:]) != string(header[8+byteLength:8+2*byteLength]) {
+		return errSetMalformed
+	}
+
+	*set = append((*set)[:0], content...)
+	return nil
+}
+
+type compressedSetStats struct {
+	count   uint64
+	min     KSUID
+	max     KSUID
+	bitmaps bool
+}
+
+// version returns the oldest version of the container format which supports
+// the encoding of the set, so readers that predate bitmaps can still load sets
+// which don't use them.
+func (stats *compressedSetStats) version() byte {
+	if stats.bitmaps {
+		return 2
+	}
+	return 1
+}
+
+// stats walks through the set to compute the summary recorded in containers.
+// Ranges are not expanded, and the minimum and maximum are tracked across all
+// entries so sets concatenated by AppendCompressed are summarized correctly.
+func (set CompressedSet) stats() (stats compressedSetStats, err error) {
+	it := set.Iter()
+
+	for it.Next() {
+		if stats.count == 0 || Compare(it.KSUID, stats.min) < 0 {
+			stats.min = it.KSUID
+		}
+
+		stats.count += 1 + it.remaining()
+		stats.bitmaps = stats.bitmaps || it.bitmap != nil
+		it.skipEntry()
+
+		if Compare(it.KSUID, stats.max) > 0 {
+			stats.max = it.KSUID
+		}
+	}
+
+	err = it.Err()
+	return
+}
+
+func crc32Checksum(b []byte) uint32 {
+	return crc32.Checksum(b, crc32c)
+}
+
+func appendUint64(b []byte, v uint64) []byte {
+	c := [8]byte{}
+	binary.BigEndian.PutUint64(c[:], v)
+	return append(b, c[:]...)
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	c := [4]byte{}
+	binary.BigEndian.PutUint32(c[:], v)
+	return append(b, c[:]...)
+}
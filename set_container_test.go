@@ -0,0 +1,186 @@
+package ksuid
+
+import (
+	"bytes"
+	"encoding"
+	"testing"
+)
+
+var (
+	_ encoding.BinaryMarshaler   = CompressedSet(nil)
+	_ encoding.BinaryUnmarshaler = (*CompressedSet)(nil)
+)
+
+func TestCompressedSetContainer(t *testing.T) {
+	ids := makeSequences(1)[:1000]
+	for i := 0; i < 100; i++ {
+		ids = append(ids, New())
+	}
+	Sort(ids)
+
+	sets := []struct {
+		scenario string
+		set      CompressedSet
+	}{
+		{scenario: "empty", set: nil},
+		{scenario: "single", set: Compress(ids[0])},
+		{scenario: "mixed", set: Compress(ids...)},
+		{scenario: "concatenated", set: AppendCompressed(Compress(ids[500:]...), ids[:500]...)},
+	}
+
+	for _, test := range sets {
+		t.Run(test.scenario, func(t *testing.T) {
+			b, err := test.set.MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.HasPrefix(b, []byte(containerMagic)) {
+				t.Error("the container does not start with the magic sequence")
+			}
+
+			var set CompressedSet
+			if err := set.UnmarshalBinary(b); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(set, test.set) {
+				t.Error("the set was not preserved")
+			}
+
+			stats, _ := test.set.stats()
+			if stats.count != uint64(test.set.Len()) {
+				t.Errorf("bad count in the container: expected %d but got %d", test.set.Len(), stats.count)
+			}
+		})
+	}
+
+	t.Run("the minimum and maximum are recorded in the header", func(t *testing.T) {
+		b, _ := AppendCompressed(Compress(ids[500:]...), ids[:500]...).MarshalBinary()
+		header := b[len(containerMagic)+1+8:]
+
+		if !bytes.Equal(header[:byteLength], ids[0][:]) {
+			t.Errorf("bad minimum KSUID: %x", header[:byteLength])
+		}
+		if !bytes.Equal(header[byteLength:2*byteLength], ids[len(ids)-1][:]) {
+			t.Errorf("bad maximum KSUID: %x", header[byteLength:2*byteLength])
+		}
+	})
+
+	t.Run("headerless sets are still supported", func(t *testing.T) {
+		var set CompressedSet
+
+		for _, legacy := range []CompressedSet{nil, Compress(ids[0]), Compress(ids...)} {
+			if err := set.UnmarshalBinary(legacy); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(set, legacy) {
+				t.Error("the headerless set was not preserved")
+			}
+		}
+
+		if err := set.UnmarshalBinary([]byte{payloadDelta | 17}); err != errSetMalformed {
+			t.Errorf("expected a malformed set error but got %v", err)
+		}
+	})
+
+	t.Run("the oldest version able to decode the set is recorded", func(t *testing.T) {
+		for _, test := range []struct {
+			set     CompressedSet
+			version byte
+		}{
+			{set: Compress(ids...), version: 1},
+			{set: Compress(makeSparseSequences(1, 4)...), version: 2},
+		} {
+			b, _ := test.set.MarshalBinary()
+
+			if v := b[len(containerMagic)]; v != test.version {
+				t.Errorf("bad container version: expected %d but got %d", test.version, v)
+			}
+
+			// A set using bitmaps must not be labeled with a version that
+			// predates them, even if the checksum is valid.
+			c := append([]byte{}, b[:len(b)-containerTrailerLength]...)
+			c[len(containerMagic)] = 1
+			c = appendUint32(c, crc32Checksum(c))
+
+			var set CompressedSet
+			err := set.UnmarshalBinary(c)
+
+			switch {
+			case test.version == 1 && err != nil:
+				t.Error(err)
+			case test.version == 2 && err != errSetMalformed:
+				t.Errorf("expected a malformed set error but got %v", err)
+			}
+		}
+	})
+
+	t.Run("unmarshaling copies the input", func(t *testing.T) {
+		b, _ := Compress(ids...).MarshalBinary()
+
+		var set CompressedSet
+		set.UnmarshalBinary(b)
+
+		for i := range b {
+			b[i] = 0
+		}
+
+		if !bytes.Equal(set, Compress(ids...)) {
+			t.Error("the set references the input buffer")
+		}
+	})
+}
+
+func TestCompressedSetContainerCorruption(t *testing.T) {
+	ids := makeSequences(1)[:100]
+	for i := 0; i < 10; i++ {
+		ids = append(ids, New())
+	}
+
+	b, err := Compress(ids...).MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var set CompressedSet
+
+	t.Run("every bit flip is detected", func(t *testing.T) {
+		for i := len(containerMagic); i < len(b); i++ {
+			for j := uint(0); j < 8; j++ {
+				c := append([]byte{}, b...)
+				c[i] ^= 1 << j
+
+				if err := set.UnmarshalBinary(c); err == nil {
+					t.Fatalf("flipping bit %d of byte %d was not detected", j, i)
+				}
+			}
+		}
+	})
+
+	t.Run("truncated containers are rejected", func(t *testing.T) {
+		for i := len(containerMagic); i < len(b); i++ {
+			if err := set.UnmarshalBinary(b[:i]); err == nil {
+				t.Fatalf("truncating the container to %d bytes was not detected", i)
+			}
+		}
+	})
+
+	t.Run("unknown versions are rejected", func(t *testing.T) {
+		c := append([]byte{}, b...)
+		c[len(containerMagic)] = containerVersion + 1
+
+		if err := set.UnmarshalBinary(c); err != errSetVersion {
+			t.Errorf("expected an unsupported version error but got %v", err)
+		}
+	})
+
+	t.Run("a valid checksum over an invalid header is rejected", func(t *testing.T) {
+		c := append([]byte{}, b[:len(b)-containerTrailerLength]...)
+		c[len(containerMagic)+1+7]++ // count
+		c = appendUint32(c, crc32Checksum(c))
+
+		if err := set.UnmarshalBinary(c); err != errSetMalformed {
+			t.Errorf("expected a malformed set error but got %v", err)
+		}
+	})
+}
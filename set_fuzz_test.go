@@ -0,0 +1,74 @@
+//go:build go1.18
+// +build go1.18
+
+package ksuid
+
+import (
+	"testing"
+	"time"
+)
+
+func FuzzCompressedSet(f *testing.F) {
+	now := time.Now()
+	seq := Sequence{Seed: New()}
+
+	ids := make([]KSUID, 0, 100)
+	for i := 0; i < 50; i++ {
+		id, _ := seq.Next()
+		ids = append(ids, id)
+	}
+	for i := 0; i < 50; i++ {
+		id, _ := NewRandomWithTime(now.Add(time.Duration(i%5) * time.Second))
+		ids = append(ids, id)
+	}
+
+	f.Add([]byte{})
+	f.Add([]byte(Compress(New())))
+	f.Add([]byte(Compress(ids...)))
+	f.Add([]byte(Compress(ids[0], ids[2], ids[3], ids[5], ids[8], ids[13], ids[21], ids[34])))
+
+	// Deltas and ranges overflowing the timestamp or the payload.
+	raw := append([]byte{rawKSUID}, Max[:]...)
+	f.Add(append(append(raw[:len(raw):len(raw)], timeDelta|1, 1), ids[0][timestampLengthInBytes:]...))
+	f.Add(append(raw[:len(raw):len(raw)], payloadDelta|1, 1))
+	f.Add(append(raw[:len(raw):len(raw)], payloadRange|1, 3))
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		set := CompressedSet(b)
+		err := ValidateCompressedSet(b)
+
+		// Ranges may expand to billions of KSUIDs, only iterate over a prefix
+		// of the set.
+		n, it := 0, set.Iter()
+		for n < 1000 {
+			// Only raw KSUIDs and bitmaps may go back, the other entries
+			// are added to the previous KSUID.
+			prev, ordered := it.KSUID, it.inEntry()
+			if !ordered && it.offset < len(b) {
+				ordered = b[it.offset]&payloadRange != rawKSUID
+			}
+
+			if !it.Next() {
+				break
+			}
+			if n != 0 && ordered && Compare(prev, it.KSUID) > 0 {
+				t.Fatalf("KSUIDs going backwards: %s after %s", it.KSUID, prev)
+			}
+			n++
+		}
+
+		if n < 1000 && it.Err() != err {
+			t.Fatalf("iterator and validation disagree: %v != %v", it.Err(), err)
+		}
+
+		if err == nil && n < 1000 && set.Len() != n {
+			t.Fatalf("bad length of valid set: expected %d but got %d", n, set.Len())
+		}
+
+		set.Contains(Max)
+
+		seek := set.Iter()
+		seek.Seek(Max)
+		seek.Seek(Nil)
+	})
+}
@@ -0,0 +1,236 @@
+package ksuid
+
+import "sync"
+
+// MutableSet is a set of KSUIDs which supports insertions and deletions.
+//
+// The set is made of an immutable CompressedSet base, and of small sorted
+// overlays recording the KSUIDs inserted and deleted since the base was built.
+// When the overlays grow past a threshold, they are compacted into a new base,
+// so the set keeps the memory footprint of a compressed set while updates
+// remain cheap.
+//
+// MutableSet values are safe to use concurrently from multiple goroutines.
+// Reads share a lock and never block each other, and iterators work on a
+// snapshot of the set taken when they were created.
+type MutableSet struct {
+	mutex     sync.RWMutex
+	base      *IndexedCompressedSet
+	baseLen   int
+	inserts   []KSUID // sorted, none of them are in base
+	deletes   []KSUID // sorted, all of them are in base
+	threshold int
+}
+
+// DefaultCompactionThreshold is the number of pending insertions and deletions
+// after which a MutableSet created with no explicit threshold is compacted.
+const DefaultCompactionThreshold = 1024
+
+// NewMutableSet returns a MutableSet which initially holds the KSUIDs of base,
+// and compacts its pending changes into a new CompressedSet when there are
+// more than threshold of them. If threshold is zero or negative,
+// DefaultCompactionThreshold is used.
+func NewMutableSet(base CompressedSet, threshold int) *MutableSet {
+	if threshold <= 0 {
+		threshold = DefaultCompactionThreshold
+	}
+	return &MutableSet{
+		base:      NewIndexedCompressedSet(base, 0),
+		baseLen:   base.Len(),
+		threshold: threshold,
+	}
+}
+
+// Insert adds id to the set.
+func (set *MutableSet) Insert(id KSUID) {
+	set.mutex.Lock()
+	defer set.mutex.Unlock()
+
+	if i, found := searchKSUIDs(set.deletes, id); found {
+		set.deletes = removeKSUID(set.deletes, i)
+		return
+	}
+
+	if i, found := searchKSUIDs(set.inserts, id); !found && !set.base.Contains(id) {
+		set.inserts = insertKSUID(set.inserts, i, id)
+		set.compactIfNeeded()
+	}
+}
+
+// Delete removes id from the set.
+func (set *MutableSet) Delete(id KSUID) {
+	set.mutex.Lock()
+	defer set.mutex.Unlock()
+
+	if i, found := searchKSUIDs(set.inserts, id); found {
+		set.inserts = removeKSUID(set.inserts, i)
+		return
+	}
+
+	if i, found := searchKSUIDs(set.deletes, id); !found && set.base.Contains(id) {
+		set.deletes = insertKSUID(set.deletes, i, id)
+		set.compactIfNeeded()
+	}
+}
+
+// Contains returns true if id is part of the set.
+func (set *MutableSet) Contains(id KSUID) bool {
+	set.mutex.RLock()
+	defer set.mutex.RUnlock()
+
+	if _, found := searchKSUIDs(set.inserts, id); found {
+		return true
+	}
+
+	if _, found := searchKSUIDs(set.deletes, id); found {
+		return false
+	}
+
+	return set.base.Contains(id)
+}
+
+// Len returns the number of KSUIDs in the set.
+func (set *MutableSet) Len() int {
+	set.mutex.RLock()
+	defer set.mutex.RUnlock()
+	return set.baseLen + len(set.inserts) - len(set.deletes)
+}
+
+// Iter returns an iterator that produces all KSUIDs in the set, in order.
+//
+// The iterator sees the content of the set at the time Iter was called, later
+// insertions and deletions do not affect it.
+func (set *MutableSet) Iter() MutableSetIter {
+	set.mutex.RLock()
+	defer set.mutex.RUnlock()
+
+	// The overlays are copied on write, so the iterator can safely retain
+	// them without holding the lock.
+	return MutableSetIter{
+		base:    set.base.Iter(),
+		inserts: set.inserts,
+		deletes: set.deletes,
+	}
+}
+
+// Compact merges the pending insertions and deletions into a new base for the
+// set. Compaction happens automatically when the number of pending changes
+// exceeds the threshold, so calling Compact is usually not necessary.
+func (set *MutableSet) Compact() {
+	set.mutex.Lock()
+	defer set.mutex.Unlock()
+	set.compact()
+}
+
+// CompressedSet returns an immutable snapshot of the set, compacting the
+// pending changes if there are any.
+func (set *MutableSet) CompressedSet() CompressedSet {
+	set.mutex.Lock()
+	defer set.mutex.Unlock()
+	set.compact()
+	return set.base.Set()
+}
+
+func (set *MutableSet) compactIfNeeded() {
+	if len(set.inserts)+len(set.deletes) > set.threshold {
+		set.compact()
+	}
+}
+
+func (set *MutableSet) compact() {
+	if len(set.inserts) == 0 && len(set.deletes) == 0 {
+		return
+	}
+
+	base := set.base.Set()
+	base = base.Union(Compress(set.inserts...))
+	base = base.Difference(Compress(set.deletes...))
+
+	set.base = NewIndexedCompressedSet(base, 0)
+	set.baseLen += len(set.inserts) - len(set.deletes)
+	set.inserts = nil
+	set.deletes = nil
+}
+
+// MutableSetIter is an iterator type returned by MutableSet.Iter to produce
+// the list of KSUIDs stored in a set.
+//
+// MutableSetIter values are not safe to use concurrently from multiple
+// goroutines.
+type MutableSetIter struct {
+	// KSUID is modified by calls to the Next method to hold the KSUID loaded
+	// by the iterator.
+	KSUID KSUID
+
+	base    CompressedSetIter
+	pending bool // base.KSUID is loaded but was not produced yet
+	done    bool // base has no more KSUIDs
+
+	inserts []KSUID
+	deletes []KSUID
+}
+
+// Next moves the iterator forward, returning true if there a KSUID was found,
+// or false if the iterator as reached the end of the set.
+func (it *MutableSetIter) Next() bool {
+	for {
+		if !it.pending && !it.done {
+			it.pending = it.base.Next()
+			it.done = !it.pending
+		}
+
+		if it.pending && (len(it.inserts) == 0 || Compare(it.base.KSUID, it.inserts[0]) < 0) {
+			id := it.base.KSUID
+			it.pending = false
+
+			for len(it.deletes) != 0 && Compare(it.deletes[0], id) < 0 {
+				it.deletes = it.deletes[1:]
+			}
+
+			if len(it.deletes) != 0 && it.deletes[0] == id {
+				it.deletes = it.deletes[1:]
+				continue
+			}
+
+			it.KSUID = id
+			return true
+		}
+
+		if len(it.inserts) != 0 {
+			it.KSUID = it.inserts[0]
+			it.inserts = it.inserts[1:]
+			return true
+		}
+
+		return false
+	}
+}
+
+// ID returns the KSUID that the iterator is positioned on.
+func (it *MutableSetIter) ID() KSUID {
+	return it.KSUID
+}
+
+// searchKSUIDs returns the index where id is or would be inserted in the sorted
+// slice ids, and whether it was found.
+func searchKSUIDs(ids []KSUID, id KSUID) (int, bool) {
+	i := Search(ids, id)
+	return i, i < len(ids) && ids[i] == id
+}
+
+// insertKSUID returns a copy of ids with id inserted at index i.
+func insertKSUID(ids []KSUID, i int, id KSUID) []KSUID {
+	c := make([]KSUID, len(ids)+1)
+	copy(c, ids[:i])
+	c[i] = id
+	copy(c[i+1:], ids[i:])
+	return c
+}
+
+// removeKSUID returns a copy of ids without the KSUID at index i.
+func removeKSUID(ids []KSUID, i int) []KSUID {
+	c := make([]KSUID, len(ids)-1)
+	copy(c, ids[:i])
+	copy(c[i:], ids[i+1:])
+	return c
+}
@@ -0,0 +1,170 @@
+package ksuid
+
+import (
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+func TestMutableSet(t *testing.T) {
+	ids := makeSequences(1)[:1000]
+	for i := 0; i < 1000; i++ {
+		ids = append(ids, New())
+	}
+	Sort(ids)
+
+	base := Compress(ids[:1000]...)
+
+	for _, threshold := range []int{1, 10, 0} {
+		t.Run("", func(t *testing.T) {
+			set := NewMutableSet(base, threshold)
+			model := make(map[KSUID]bool)
+
+			for _, id := range ids[:1000] {
+				model[id] = true
+			}
+
+			prng := rand.New(rand.NewSource(int64(threshold)))
+
+			for i := 0; i < 5000; i++ {
+				id := ids[prng.Intn(len(ids))]
+
+				if prng.Intn(2) == 0 {
+					set.Insert(id)
+					model[id] = true
+				} else {
+					set.Delete(id)
+					delete(model, id)
+				}
+
+				if set.Contains(id) != model[id] {
+					t.Fatalf("bad membership of %s after operation %d", id, i)
+				}
+
+				if (i % 500) == 0 {
+					testMutableSetContent(t, set, ids, model)
+				}
+			}
+
+			testMutableSetContent(t, set, ids, model)
+
+			snapshot := set.CompressedSet()
+			if snapshot.Len() != len(model) {
+				t.Errorf("bad snapshot length: expected %d but got %d", len(model), snapshot.Len())
+			}
+			testMutableSetContent(t, set, ids, model)
+		})
+	}
+}
+
+func testMutableSetContent(t *testing.T, set *MutableSet, ids []KSUID, model map[KSUID]bool) {
+	t.Helper()
+
+	if n := set.Len(); n != len(model) {
+		t.Fatalf("bad length: expected %d but got %d", len(model), n)
+	}
+
+	expect := []KSUID{}
+	for _, id := range ids {
+		if model[id] {
+			expect = append(expect, id)
+		}
+	}
+
+	i := 0
+	for it := set.Iter(); it.Next(); i++ {
+		if i >= len(expect) {
+			t.Fatal("too many KSUIDs were produced by the iterator")
+		}
+		if it.KSUID != expect[i] {
+			t.Fatalf("bad KSUID at index %d: expected %s but found %s", i, expect[i], it.KSUID)
+		}
+	}
+
+	if i != len(expect) {
+		t.Fatalf("expected %d KSUIDs but found %d", len(expect), i)
+	}
+}
+
+func TestMutableSetIterSnapshot(t *testing.T) {
+	ids := []KSUID{New(), New(), New(), New()}
+	Sort(ids)
+
+	set := NewMutableSet(Compress(ids[0], ids[2]), 1)
+	set.Insert(ids[1])
+
+	it := set.Iter()
+
+	set.Delete(ids[0])
+	set.Insert(ids[3])
+	set.Compact()
+
+	found := []KSUID{}
+	for it.Next() {
+		found = append(found, it.KSUID)
+	}
+
+	if len(found) != 3 || found[0] != ids[0] || found[1] != ids[1] || found[2] != ids[2] {
+		t.Error("the iterator was affected by changes made after it was created:", found)
+	}
+}
+
+func TestMutableSetConcurrency(t *testing.T) {
+	ids := make([]KSUID, 1000)
+	for i := range ids {
+		ids[i] = New()
+	}
+
+	set := NewMutableSet(nil, 50)
+	wg := sync.WaitGroup{}
+
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+
+		go func(i int) {
+			defer wg.Done()
+			for j := i; j < len(ids); j += 4 {
+				set.Insert(ids[j])
+				if (j % 3) == 0 {
+					set.Delete(ids[j])
+				}
+			}
+		}(i)
+
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				for it := set.Iter(); it.Next(); {
+				}
+				set.Contains(ids[j])
+				set.Len()
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	for j, id := range ids {
+		if set.Contains(id) != ((j % 3) != 0) {
+			t.Errorf("bad membership of %s", id)
+		}
+	}
+}
+
+func BenchmarkMutableSet(b *testing.B) {
+	base, _ := benchmarkSets()
+	set := NewMutableSet(base, 0)
+
+	b.Run("insert", func(b *testing.B) {
+		for i := 0; i != b.N; i++ {
+			set.Insert(New())
+		}
+	})
+
+	b.Run("contains", func(b *testing.B) {
+		id := New()
+		for i := 0; i != b.N; i++ {
+			set.Contains(id)
+		}
+	})
+}
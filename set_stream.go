@@ -0,0 +1,240 @@
+package ksuid
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// CompressedSetWriter builds a compressed set from a stream of sorted KSUIDs,
+// writing the encoded set to an io.Writer as it goes.
+//
+// Unlike AppendCompressed, which needs the whole list of KSUIDs in memory and
+// sorts it in place, the writer only holds a small buffer and never modifies
+// its input, which makes it suitable to build sets of hundreds of millions of
+// KSUIDs read from a sorted source like a database cursor. The bytes written
+// are the same as those produced by Compress for the same KSUIDs.
+//
+// A typical usage of a CompressedSetWriter looks like this:
+//
+//	w := ksuid.NewCompressedSetWriter(f)
+//	for rows.Next() {
+//		// ...
+//		if err := w.Add(id); err != nil {
+//			return err
+//		}
+//	}
+//	if err := w.Close(); err != nil {
+//		return err
+//	}
+//
+// CompressedSetWriter values are not safe to use concurrently from multiple
+// goroutines.
+type CompressedSetWriter struct {
+	w   io.Writer
+	b   compressedSetBuilder
+	err error
+}
+
+// The size of the buffer accumulated by a CompressedSetWriter before it is
+// written to the underlying io.Writer.
+const compressedSetWriterBufferSize = 4096
+
+// NewCompressedSetWriter returns a CompressedSetWriter which writes the set it
+// builds to w.
+func NewCompressedSetWriter(w io.Writer) *CompressedSetWriter {
+	return &CompressedSetWriter{
+		w: w,
+		b: compressedSetBuilder{set: make([]byte, 0, compressedSetWriterBufferSize+maxEntryLength)},
+	}
+}
+
+// Add adds id to the set. KSUIDs must be added in order, Add returns an error
+// and leaves the set unchanged if id is lower than the last KSUID that was
+// added. Adding the same KSUID more than once is allowed, it appears only once
+// in the set.
+//
+// Errors returned by the underlying io.Writer are sticky, once an error was
+// returned all calls to Add and Close return the same error.
+func (w *CompressedSetWriter) Add(id KSUID) error {
+	if w.err != nil {
+		return w.err
+	}
+
+	if w.b.started && Compare(id, w.b.lastKSUID) < 0 {
+		return errOutOfOrder
+	}
+
+	w.b.add(id)
+
+	// The current group of KSUIDs may still be rewritten as a bitmap, only the
+	// bytes that precede it can be written.
+	if w.b.groupStart >= compressedSetWriterBufferSize {
+		w.flush(w.b.groupStart)
+	}
+
+	return w.err
+}
+
+// Close writes the remaining bytes of the set to the underlying io.Writer. It
+// does not close the io.Writer.
+func (w *CompressedSetWriter) Close() error {
+	if w.err == nil {
+		w.b.closeGroup()
+		w.flush(len(w.b.set))
+	}
+
+	switch w.err {
+	case nil, errWriterClosed:
+		w.err = errWriterClosed
+		return nil
+	default:
+		return w.err
+	}
+}
+
+// flush writes the first n bytes of the buffer to the underlying io.Writer.
+func (w *CompressedSetWriter) flush(n int) {
+	if n != 0 {
+		_, w.err = w.w.Write(w.b.set[:n])
+		w.b.set = w.b.set[:copy(w.b.set, w.b.set[n:])]
+		w.b.groupStart -= n
+	}
+}
+
+// CompressedSetReader decodes a compressed set from an io.Reader, producing
+// its KSUIDs one at a time without loading the whole set in memory.
+//
+// Here's is how the reader type is commonly used:
+//
+//	r := ksuid.NewCompressedSetReader(f)
+//	for r.Next() {
+//		id := r.KSUID
+//		// ...
+//	}
+//	if err := r.Err(); err != nil {
+//		return err
+//	}
+//
+// CompressedSetReader values are not safe to use concurrently from multiple
+// goroutines.
+type CompressedSetReader struct {
+	// KSUID is modified by calls to the Next method to hold the KSUID loaded
+	// by the reader.
+	KSUID KSUID
+
+	r   *bufio.Reader
+	it  CompressedSetIter
+	buf []byte
+	err error
+}
+
+// NewCompressedSetReader returns a CompressedSetReader which decodes the set
+// read from r.
+func NewCompressedSetReader(r io.Reader) *CompressedSetReader {
+	return &CompressedSetReader{r: bufio.NewReader(r)}
+}
+
+// Next moves the reader forward, returning true if a KSUID was found, or false
+// if the reader has reached the end of the stream or an error occurred.
+func (r *CompressedSetReader) Next() bool {
+	if r.err != nil {
+		return false
+	}
+
+	if !r.it.inEntry() {
+		if !r.readEntry() {
+			return false
+		}
+	}
+
+	if !r.it.Next() {
+		r.err = r.it.Err()
+		return false
+	}
+
+	r.KSUID = r.it.KSUID
+	return true
+}
+
+// ID returns the KSUID that the reader is positioned on.
+func (r *CompressedSetReader) ID() KSUID {
+	return r.KSUID
+}
+
+// Err returns the error that caused the reader to stop, or nil if it reached
+// the end of the stream, or has not stopped yet.
+func (r *CompressedSetReader) Err() error {
+	if r.err == io.EOF {
+		return nil
+	}
+	return r.err
+}
+
+// readEntry loads the next entry of the stream as the content of the iterator,
+// which carries the state needed to decode deltas from one entry to the next.
+func (r *CompressedSetReader) readEntry() bool {
+	b, err := r.r.ReadByte()
+	if err != nil {
+		r.err = err
+		return false
+	}
+
+	n, err := entryLength(b)
+	if err != nil {
+		r.err = err
+		return false
+	}
+
+	r.buf = append(r.buf[:0], b)
+	if !r.read(n) {
+		return false
+	}
+
+	if b == payloadBitmap {
+		// The length of the bitmap is stored after the 18 bytes prefix and
+		// the sequence number of the first KSUID.
+		m := int(binary.BigEndian.Uint16(r.buf[1+bitmapHeaderLength-2:]))
+		if m > bitmapMaxLength {
+			r.err = errSetMalformed
+			return false
+		}
+		if !r.read(m) {
+			return false
+		}
+	}
+
+	r.it.content = r.buf
+	r.it.offset = 0
+	r.it.bitmap = nil
+	return true
+}
+
+// read appends the next n bytes of the stream to the buffer.
+func (r *CompressedSetReader) read(n int) bool {
+	i := len(r.buf)
+
+	if cap(r.buf) < i+n {
+		buf := make([]byte, i, i+n)
+		copy(buf, r.buf)
+		r.buf = buf
+	}
+
+	r.buf = r.buf[:i+n]
+
+	if _, err := io.ReadFull(r.r, r.buf[i:]); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = errSetTruncated
+		}
+		r.err = err
+		return false
+	}
+
+	return true
+}
+
+var (
+	errOutOfOrder   = errors.New("KSUIDs must be added to a compressed set in order")
+	errWriterClosed = errors.New("compressed set writer is closed")
+)
@@ -0,0 +1,185 @@
+package ksuid
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCompressedSetWriter(t *testing.T) {
+	ids := append(makeSequences(1), makeSparseSequences(1, 5)...)
+	now := time.Now()
+	for i := 0; i < 1000; i++ {
+		id, _ := NewRandomWithTime(now.Add(time.Duration(i%20) * time.Second))
+		ids = append(ids, id)
+	}
+	Sort(ids)
+
+	t.Run("the writer produces the same bytes as Compress", func(t *testing.T) {
+		b := &bytes.Buffer{}
+		w := NewCompressedSetWriter(b)
+
+		for i, id := range ids {
+			if err := w.Add(id); err != nil {
+				t.Fatal(err)
+			}
+			if (i % 100) == 0 {
+				w.Add(id) // duplicates are ignored
+			}
+		}
+
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(b.Bytes(), Compress(ids...)) {
+			t.Error("the writer and Compress produced different sets")
+		}
+	})
+
+	t.Run("KSUIDs added out of order are rejected", func(t *testing.T) {
+		b := &bytes.Buffer{}
+		w := NewCompressedSetWriter(b)
+
+		if err := w.Add(ids[1]); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Add(ids[0]); err != errOutOfOrder {
+			t.Errorf("expected an out of order error but got %v", err)
+		}
+		if err := w.Add(ids[2]); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(b.Bytes(), Compress(ids[1], ids[2])) {
+			t.Error("the rejected KSUID was written to the set")
+		}
+	})
+
+	t.Run("errors from the underlying writer are reported", func(t *testing.T) {
+		w := NewCompressedSetWriter(errorWriter{})
+
+		var err error
+		for _, id := range ids {
+			if err = w.Add(id); err != nil {
+				break
+			}
+		}
+		if err != errWrite {
+			t.Errorf("expected a write error from Add but got %v", err)
+		}
+		if err := w.Close(); err != errWrite {
+			t.Errorf("expected a write error from Close but got %v", err)
+		}
+	})
+
+	t.Run("adding KSUIDs after closing the writer fails", func(t *testing.T) {
+		w := NewCompressedSetWriter(&bytes.Buffer{})
+
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Add(ids[0]); err == nil {
+			t.Error("no error returned when adding a KSUID to a closed writer")
+		}
+		if err := w.Close(); err != nil {
+			t.Error("closing the writer twice failed:", err)
+		}
+	})
+}
+
+func TestCompressedSetReader(t *testing.T) {
+	ids := append(makeSequences(1), makeSparseSequences(1, 5)...)
+	for i := 0; i < 1000; i++ {
+		ids = append(ids, New())
+	}
+	Sort(ids)
+
+	set := Compress(ids...)
+
+	t.Run("the reader produces all KSUIDs of the set", func(t *testing.T) {
+		r := NewCompressedSetReader(bytes.NewReader(set))
+		i := 0
+
+		for r.Next() {
+			if i >= len(ids) {
+				t.Fatal("too many KSUIDs were produced by the reader")
+			}
+			if r.KSUID != ids[i] {
+				t.Fatalf("bad KSUID at index %d: expected %s but found %s", i, ids[i], r.KSUID)
+			}
+			i++
+		}
+
+		if err := r.Err(); err != nil {
+			t.Error(err)
+		}
+		if i != len(ids) {
+			t.Errorf("expected %d KSUIDs but found %d", len(ids), i)
+		}
+	})
+
+	t.Run("truncated sets are reported as errors", func(t *testing.T) {
+		for _, n := range []int{1, byteLength, len(set) - 1} {
+			r := NewCompressedSetReader(bytes.NewReader(set[:n]))
+			for r.Next() {
+			}
+			if err := r.Err(); err != errSetTruncated {
+				t.Errorf("expected a truncation error after %d bytes but got %v", n, err)
+			}
+		}
+	})
+
+	t.Run("malformed sets are reported as errors", func(t *testing.T) {
+		r := NewCompressedSetReader(bytes.NewReader([]byte{payloadDelta | 17}))
+		if r.Next() {
+			t.Error("a KSUID was read from a malformed set")
+		}
+		if err := r.Err(); err != errSetMalformed {
+			t.Errorf("expected a malformed set error but got %v", err)
+		}
+	})
+}
+
+var errWrite = errors.New("write error")
+
+type errorWriter struct{}
+
+func (errorWriter) Write([]byte) (int, error) { return 0, errWrite }
+
+func BenchmarkCompressedSetWriter(b *testing.B) {
+	set, _ := benchmarkSets()
+
+	ids := make([]KSUID, 0, 1000000)
+	for it := set.Iter(); it.Next(); {
+		ids = append(ids, it.KSUID)
+	}
+
+	buf := &bytes.Buffer{}
+
+	for i := 0; i != b.N; i++ {
+		buf.Reset()
+		w := NewCompressedSetWriter(buf)
+		for _, id := range ids {
+			w.Add(id)
+		}
+		w.Close()
+	}
+
+	b.SetBytes(int64(len(set)))
+}
+
+func BenchmarkCompressedSetReader(b *testing.B) {
+	set, _ := benchmarkSets()
+
+	for i := 0; i != b.N; i++ {
+		for r := NewCompressedSetReader(bytes.NewReader(set)); r.Next(); {
+		}
+	}
+
+	b.SetBytes(int64(len(set)))
+}
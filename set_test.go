@@ -1,6 +1,13 @@
 package ksuid
 
 import (
+	"bytes"
+	"fmt"
+	"math"
+	"math/rand"
+	"reflect"
+	"sort"
+	"sync"
 	"testing"
 	"time"
 )
@@ -50,6 +57,18 @@ func TestCompressedSet(t *testing.T) {
 			scenario: "iterating over a compressed sequence returns the full sequence",
 			function: testCompressedSetSequence,
 		},
+		{
+			scenario: "the length of a compressed set counts ids in ranges without expanding them",
+			function: testCompressedSetLen,
+		},
+		{
+			scenario: "membership tests find ids inside and at the edges of ranges",
+			function: testCompressedSetContains,
+		},
+		{
+			scenario: "sequences with gaps are stored as bitmaps when it saves space",
+			function: testCompressedSetBitmap,
+		},
 	}
 
 	for _, test := range tests {
@@ -261,6 +280,188 @@ func testCompressedSetSequence(t *testing.T) {
 	}
 }
 
+// makeSequences returns the sorted content of n sequences seeded with new
+// KSUIDs, each of which forms a range of 65536 contiguous ids.
+func makeSequences(n int) []KSUID {
+	ids := make([]KSUID, 0, n*(math.MaxUint16+1))
+
+	for i := 0; i < n; i++ {
+		seq := Sequence{Seed: New()}
+		for {
+			id, err := seq.Next()
+			if err != nil {
+				break
+			}
+			ids = append(ids, id)
+		}
+	}
+
+	Sort(ids)
+	return ids
+}
+
+func testCompressedSetLen(t *testing.T) {
+	ids := makeSequences(3)
+	for i := 0; i < 1000; i++ {
+		ids = append(ids, New())
+	}
+	ids = append(ids, ids[:10]...) // duplicates are not counted
+	Sort(ids)
+
+	if n := Compress(ids...).Len(); n != len(ids)-10 {
+		t.Errorf("bad length: expected %d but got %d", len(ids)-10, n)
+	}
+
+	if n := CompressedSet(nil).Len(); n != 0 {
+		t.Errorf("bad length of nil set: %d", n)
+	}
+
+	// A few bytes are enough to encode more KSUIDs than an int can count.
+	huge := append([]byte{rawKSUID}, Nil[:]...)
+	huge = append(huge, payloadRange|8, 0x40, 0, 0, 0, 0, 0, 0, 0)
+	huge = append(huge, payloadRange|8, 0x40, 0, 0, 0, 0, 0, 0, 0)
+
+	if n := CompressedSet(huge).Len(); n != maxInt {
+		t.Errorf("bad length of a set with 2^63+1 KSUIDs: expected %d but got %d", maxInt, n)
+	}
+
+	huge = append(huge[:byteLength+1], payloadRange|8, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF)
+
+	if n := CompressedSet(huge).Len(); n != maxInt {
+		t.Errorf("bad length of a set with 2^64 KSUIDs: expected %d but got %d", maxInt, n)
+	}
+}
+
+func testCompressedSetContains(t *testing.T) {
+	ids := makeSequences(2)
+	ids = append(ids, New(), New(), New())
+	Sort(ids)
+
+	set := Compress(ids...)
+
+	for _, id := range ids {
+		if !set.Contains(id) {
+			t.Fatalf("id %s was not found in the set", id)
+		}
+	}
+
+	missing := []KSUID{Nil, Max, ids[0].Prev(), ids[len(ids)-1].Next(), New()}
+
+	for i := 1; i < len(ids); i++ {
+		if next := ids[i-1].Next(); next != ids[i] {
+			missing = append(missing, next, ids[i].Prev())
+		}
+	}
+
+	for _, id := range missing {
+		if set.Contains(id) {
+			t.Errorf("id %s was found in the set but was never added", id)
+		}
+	}
+
+	if CompressedSet(nil).Contains(Nil) {
+		t.Error("the nil set must not contain any ids")
+	}
+}
+
+// makeSparseSequences returns the sorted content of n sequences seeded with new
+// KSUIDs, keeping only one KSUID out of every k on average.
+func makeSparseSequences(n int, k int) []KSUID {
+	prng := rand.New(rand.NewSource(int64(k)))
+	ids := makeSequences(n)
+	sparse := ids[:0]
+
+	for _, id := range ids {
+		if prng.Intn(k) == 0 {
+			sparse = append(sparse, id)
+		}
+	}
+
+	return sparse
+}
+
+func compressWithoutBitmaps(ids ...KSUID) CompressedSet {
+	b := compressedSetBuilder{noBitmaps: true}
+	for _, id := range ids {
+		b.add(id)
+	}
+	return b.compressedSet()
+}
+
+func testCompressedSetBitmap(t *testing.T) {
+	ids := makeSparseSequences(3, 4)
+
+	// Mix in sequences with few KSUIDs, which are not worth storing as
+	// bitmaps, and KSUIDs at the edges of the sequence numbers space.
+	seq := Sequence{Seed: New()}
+	for i := 0; i < 3; i++ {
+		id, _ := seq.Next()
+		ids = append(ids, id)
+	}
+	seed := New()
+	ids = append(ids, withSequenceNumber(seed, 0), withSequenceNumber(seed, 2), withSequenceNumber(seed, math.MaxUint16))
+	for i := 0; i < 100; i++ {
+		ids = append(ids, New())
+	}
+	Sort(ids)
+
+	set := Compress(ids...)
+	ref := compressWithoutBitmaps(ids...)
+
+	if len(set) >= len(ref) {
+		t.Errorf("bitmaps did not reduce the size of the set: %d >= %d", len(set), len(ref))
+	}
+	reportCompressionRatio(t, ids, set)
+	reportCompressionRatio(t, ids, ref)
+
+	i := 0
+	for it := set.Iter(); it.Next(); i++ {
+		if i >= len(ids) {
+			t.Fatal("too many KSUIDs were produced by the set iterator")
+		}
+		if it.KSUID != ids[i] {
+			t.Fatalf("bad KSUID at index %d: expected %s but found %s", i, ids[i], it.KSUID)
+		}
+	}
+	if i != len(ids) {
+		t.Fatalf("expected %d KSUIDs but found %d", len(ids), i)
+	}
+
+	if err := ValidateCompressedSet(set); err != nil {
+		t.Error(err)
+	}
+
+	if n := set.Len(); n != len(ids) {
+		t.Errorf("bad length: expected %d but got %d", len(ids), n)
+	}
+
+	if max := set.MaxKSUID(); max != ids[len(ids)-1] {
+		t.Errorf("bad maximum: expected %s but got %s", ids[len(ids)-1], max)
+	}
+
+	found := make(map[KSUID]bool, len(ids))
+	for _, id := range ids {
+		found[id] = true
+	}
+
+	for i, id := range ids {
+		if !set.Contains(id) {
+			t.Fatalf("id %s was not found in the set", id)
+		}
+		if prev := id.Prev(); !found[prev] && set.Contains(prev) {
+			t.Fatalf("id %s was found in the set but was never added", prev)
+		}
+		if i%10 == 0 {
+			it := set.Iter()
+			testCompressedSetSeek(t, &it, ids, id.Prev())
+		}
+	}
+
+	if b := Compress(ids[100:200]...); !bytes.Equal(set.Range(ids[100], ids[199]), b) {
+		t.Error("the range of the set does not match the compression of the same KSUIDs")
+	}
+}
+
 func testCompressedSetNil(t *testing.T) {
 	set := CompressedSet(nil)
 
@@ -288,6 +489,728 @@ func testCompressedSetConcat(t *testing.T) {
 	}
 }
 
+func TestCompressedSetAlgebra(t *testing.T) {
+	seq := Sequence{Seed: New()}
+	now := time.Now()
+
+	ids := make([]KSUID, 0, 300)
+	for i := 0; i < 100; i++ {
+		id, _ := seq.Next()
+		ids = append(ids, id)
+	}
+	for i := 0; i < 200; i++ {
+		id, _ := NewRandomWithTime(now.Add(time.Duration(i%10) * time.Second))
+		ids = append(ids, id)
+	}
+
+	// Interleave the ids between the two sets so that some are shared, some
+	// are unique to each side, and contiguous ranges are split across sets.
+	var a, b []KSUID
+	for i, id := range ids {
+		switch i % 3 {
+		case 0:
+			a = append(a, id)
+		case 1:
+			b = append(b, id)
+		default:
+			a = append(a, id)
+			b = append(b, id)
+		}
+	}
+
+	inA := make(map[KSUID]bool)
+	inB := make(map[KSUID]bool)
+	for _, id := range a {
+		inA[id] = true
+	}
+	for _, id := range b {
+		inB[id] = true
+	}
+
+	setA := Compress(a...)
+	setB := Compress(b...)
+
+	tests := []struct {
+		scenario string
+		function func(CompressedSet, CompressedSet) CompressedSet
+		contains func(KSUID) bool
+	}{
+		{
+			scenario: "Union",
+			function: CompressedSet.Union,
+			contains: func(id KSUID) bool { return inA[id] || inB[id] },
+		},
+		{
+			scenario: "Intersect",
+			function: CompressedSet.Intersect,
+			contains: func(id KSUID) bool { return inA[id] && inB[id] },
+		},
+		{
+			scenario: "Difference",
+			function: CompressedSet.Difference,
+			contains: func(id KSUID) bool { return inA[id] && !inB[id] },
+		},
+		{
+			scenario: "SymmetricDifference",
+			function: CompressedSet.SymmetricDifference,
+			contains: func(id KSUID) bool { return inA[id] != inB[id] },
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.scenario, func(t *testing.T) {
+			expect := []KSUID{}
+			for _, id := range ids {
+				if test.contains(id) {
+					expect = append(expect, id)
+				}
+			}
+			sort.Slice(expect, func(i, j int) bool {
+				return Compare(expect[i], expect[j]) < 0
+			})
+
+			set := test.function(setA, setB)
+			found := []KSUID{}
+			for it := set.Iter(); it.Next(); {
+				found = append(found, it.KSUID)
+			}
+
+			if len(found) != len(expect) {
+				t.Fatalf("expected %d KSUIDs but found %d", len(expect), len(found))
+			}
+			for i := range expect {
+				if found[i] != expect[i] {
+					t.Errorf("bad KSUID at index %d: expected %s but found %s", i, expect[i], found[i])
+				}
+			}
+
+			if s := string(Compress(expect...)); s != string(set) {
+				t.Error("set produced by the operation does not match the encoding of Compress")
+			}
+		})
+	}
+
+	t.Run("operations on empty sets", func(t *testing.T) {
+		empty := CompressedSet(nil)
+
+		if s := setA.Union(empty); string(s) != string(setA) {
+			t.Error("union with an empty set must produce the original set")
+		}
+		if s := empty.Union(setA); string(s) != string(setA) {
+			t.Error("union of an empty set must produce the other set")
+		}
+		if s := setA.Intersect(empty); len(s) != 0 {
+			t.Error("intersection with an empty set must be empty:", s)
+		}
+		if s := setA.Difference(empty); string(s) != string(setA) {
+			t.Error("difference with an empty set must produce the original set")
+		}
+		if s := setA.Difference(setA); len(s) != 0 {
+			t.Error("difference of a set with itself must be empty:", s)
+		}
+		if s := setA.SymmetricDifference(setA); len(s) != 0 {
+			t.Error("symmetric difference of a set with itself must be empty:", s)
+		}
+	})
+}
+
+func TestCompressedSetSeek(t *testing.T) {
+	now := time.Now()
+
+	ids := make([]KSUID, 0, 10000)
+	for i := 0; i < 100; i++ {
+		seq := Sequence{Seed: New()}
+		seq.Seed, _ = NewRandomWithTime(now.Add(time.Duration(i) * time.Second))
+		for j := 0; j < 10; j++ {
+			id, _ := seq.Next()
+			ids = append(ids, id)
+		}
+		for j := 0; j < 90; j++ {
+			id, _ := NewRandomWithTime(now.Add(time.Duration(i) * time.Second))
+			ids = append(ids, id)
+		}
+	}
+	Sort(ids)
+
+	set := Compress(ids...)
+
+	// Probe a sample of the ids in the set, the ids right before and after
+	// them, and the bounds of the KSUID space.
+	probes := []KSUID{Nil, Max}
+	for i := 0; i < len(ids); i += 37 {
+		probes = append(probes, ids[i], ids[i].Prev(), ids[i].Next())
+	}
+
+	iters := []struct {
+		scenario string
+		iter     func() CompressedSetIter
+	}{
+		{
+			scenario: "without index",
+			iter:     set.Iter,
+		},
+		{
+			scenario: "with default index",
+			iter:     NewIndexedCompressedSet(set, 0).Iter,
+		},
+		{
+			scenario: "with dense index",
+			iter:     NewIndexedCompressedSet(set, 1).Iter,
+		},
+	}
+
+	for _, test := range iters {
+		t.Run(test.scenario, func(t *testing.T) {
+			for i, probe := range probes {
+				if i%10 == 0 {
+					probe = probes[len(probes)-1-i] // also seek backward
+				}
+				it := test.iter()
+				testCompressedSetSeek(t, &it, ids, probe)
+			}
+
+			// A single iterator must remain consistent when moved back and
+			// forth through the set.
+			it := test.iter()
+			for i := range probes {
+				testCompressedSetSeek(t, &it, ids, probes[(i*7919)%len(probes)])
+				testCompressedSetSeek(t, &it, ids, it.KSUID) // seek in place
+			}
+		})
+	}
+
+	t.Run("SeekTime", func(t *testing.T) {
+		index := NewIndexedCompressedSet(set, 16)
+
+		for i := 0; i < 100; i++ {
+			at := now.Add(time.Duration(i) * time.Second)
+			it := index.Iter()
+
+			if !it.SeekTime(at) {
+				t.Fatalf("no KSUIDs found after %s", at)
+			}
+			if it.KSUID.Timestamp() != timeToCorrectedUTCTimestamp(at) {
+				t.Errorf("bad KSUID found after %s: %s (%s)", at, it.KSUID, it.KSUID.Time())
+			}
+			if j := sort.Search(len(ids), func(j int) bool { return ids[j].Time().Unix() >= at.Unix() }); ids[j] != it.KSUID {
+				t.Errorf("expected %s but found %s", ids[j], it.KSUID)
+			}
+		}
+
+		it := index.Iter()
+		if it.SeekTime(now.Add(time.Hour)) {
+			t.Error("found a KSUID after the end of the set:", it.KSUID)
+		}
+
+		// Times before the epoch of KSUIDs are clamped to it.
+		it = index.Iter()
+		if !it.SeekTime(time.Unix(0, 0)) || it.KSUID != ids[0] {
+			t.Errorf("expected %s but found %s after a time before the epoch", ids[0], it.KSUID)
+		}
+	})
+
+	t.Run("Contains", func(t *testing.T) {
+		index := NewIndexedCompressedSet(set, 16)
+		found := make(map[KSUID]bool, len(ids))
+
+		for _, id := range ids {
+			found[id] = true
+		}
+
+		for _, id := range ids {
+			if !index.Contains(id) {
+				t.Fatalf("id %s was not found in the set", id)
+			}
+			if !found[id.Prev()] && index.Contains(id.Prev()) {
+				t.Fatalf("id %s was found in the set but was never added", id.Prev())
+			}
+		}
+	})
+
+	t.Run("MarshalBinary", func(t *testing.T) {
+		index1 := NewIndexedCompressedSet(set, 10)
+		index2 := &IndexedCompressedSet{}
+
+		b, err := index1.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := index2.UnmarshalBinary(b); err != nil {
+			t.Fatal(err)
+		}
+		if string(index1.Set()) != string(index2.Set()) {
+			t.Error("the compressed set was not preserved")
+		}
+		if !reflect.DeepEqual(index1, index2) {
+			t.Error("the index was not preserved")
+		}
+
+		// Truncating the index must never be accepted, the compressed set is
+		// only verified when iterating.
+		for i := 0; i < len(b)-len(set); i++ {
+			if err := index2.UnmarshalBinary(b[:i]); err == nil {
+				t.Errorf("truncated input of %d bytes was accepted", i)
+			}
+		}
+
+		// Checkpoints which do not match the set must be rejected.
+		for _, corrupt := range []func(*compressedSetCheckpoint){
+			func(cp *compressedSetCheckpoint) { cp.ksuid[byteLength-1]++ },
+			func(cp *compressedSetCheckpoint) { cp.ksuid = cp.ksuid.Next() },
+			func(cp *compressedSetCheckpoint) { cp.offset-- },
+			func(cp *compressedSetCheckpoint) { cp.offset++ },
+		} {
+			for i := range index1.checkpoints {
+				index3 := *index1
+				index3.checkpoints = append([]compressedSetCheckpoint{}, index1.checkpoints...)
+				corrupt(&index3.checkpoints[i])
+
+				c, _ := index3.MarshalBinary()
+				if err := index2.UnmarshalBinary(c); err != errIndexedSetMalformed {
+					t.Fatalf("corrupted checkpoint %d was accepted: %v", i, err)
+				}
+			}
+		}
+	})
+}
+
+func testCompressedSetSeek(t *testing.T, it *CompressedSetIter, ids []KSUID, probe KSUID) {
+	t.Helper()
+
+	i := sort.Search(len(ids), func(i int) bool { return Compare(ids[i], probe) >= 0 })
+
+	if !it.Seek(probe) {
+		if i != len(ids) {
+			t.Fatalf("seeking %s found nothing but %s was expected", probe, ids[i])
+		}
+		return
+	}
+
+	if i == len(ids) {
+		t.Fatalf("seeking %s found %s but nothing was expected", probe, it.KSUID)
+	}
+
+	if it.KSUID != ids[i] {
+		t.Fatalf("seeking %s found %s but %s was expected", probe, it.KSUID, ids[i])
+	}
+
+	// The iterator must carry on from the position it was moved to.
+	for j := i + 1; j < len(ids) && j < i+20; j++ {
+		if !it.Next() {
+			t.Fatalf("iterator ended after seeking %s, expected %s", probe, ids[j])
+		}
+		if it.KSUID != ids[j] {
+			t.Fatalf("bad KSUID after seeking %s: expected %s but found %s", probe, ids[j], it.KSUID)
+		}
+	}
+}
+
+func TestCompressedSetMalformed(t *testing.T) {
+	id := New()
+	raw := append([]byte{rawKSUID}, id[:]...)
+
+	// withRaw returns the raw KSUID entry followed by b, in a new slice so
+	// test cases don't share their backing arrays.
+	withRaw := func(b ...byte) []byte {
+		return append(append([]byte{}, raw...), b...)
+	}
+
+	// withMax is like withRaw, but the raw KSUID has the largest timestamp and
+	// payload.
+	withMax := func(b ...byte) []byte {
+		return append(append([]byte{rawKSUID}, Max[:]...), b...)
+	}
+
+	tests := []struct {
+		scenario string
+		content  []byte
+		count    int
+		err      error
+	}{
+		{
+			scenario: "truncated raw KSUID",
+			content:  raw[:byteLength],
+			err:      errSetTruncated,
+		},
+		{
+			scenario: "raw KSUID with a non-zero length",
+			content:  append([]byte{rawKSUID | 2}, id[:]...),
+			err:      errSetMalformed,
+		},
+		{
+			scenario: "time delta without a length",
+			content:  withRaw(timeDelta),
+			count:    1,
+			err:      errSetMalformed,
+		},
+		{
+			scenario: "time delta longer than a timestamp",
+			content:  withRaw(timeDelta|5, 0, 0, 0, 0, 1),
+			count:    1,
+			err:      errSetMalformed,
+		},
+		{
+			scenario: "truncated time delta",
+			content:  withRaw(timeDelta|1, 1, 0, 0, 0),
+			count:    1,
+			err:      errSetTruncated,
+		},
+		{
+			scenario: "payload delta longer than a payload",
+			content:  withRaw(payloadDelta | 17),
+			count:    1,
+			err:      errSetMalformed,
+		},
+		{
+			scenario: "truncated payload delta",
+			content:  withRaw(payloadDelta|2, 1),
+			count:    1,
+			err:      errSetTruncated,
+		},
+		{
+			scenario: "payload range longer than 8 bytes",
+			content:  withRaw(payloadRange|9, 0, 0, 0, 0, 0, 0, 0, 0, 1),
+			count:    1,
+			err:      errSetMalformed,
+		},
+		{
+			scenario: "empty payload range",
+			content:  withRaw(payloadRange|1, 0),
+			count:    1,
+			err:      errSetMalformed,
+		},
+		{
+			scenario: "truncated payload range",
+			content:  withRaw(payloadRange|2, 1),
+			count:    1,
+			err:      errSetTruncated,
+		},
+		{
+			scenario: "time delta overflowing the timestamp",
+			content:  withMax(append([]byte{timeDelta | 1, 1}, id[timestampLengthInBytes:]...)...),
+			count:    1,
+			err:      errSetMalformed,
+		},
+		{
+			scenario: "payload delta overflowing the payload",
+			content:  withMax(payloadDelta|1, 1),
+			count:    1,
+			err:      errSetMalformed,
+		},
+		{
+			scenario: "payload range overflowing the payload",
+			content:  withMax(payloadRange|1, 3),
+			count:    1,
+			err:      errSetMalformed,
+		},
+		{
+			scenario: "truncated bitmap header",
+			content:  append([]byte{payloadBitmap}, id[:bitmapPrefixLength]...),
+			err:      errSetTruncated,
+		},
+		{
+			scenario: "truncated bitmap",
+			content:  append(append([]byte{payloadBitmap}, id[:bitmapPrefixLength]...), 0, 0, 0, 2, 1),
+			err:      errSetTruncated,
+		},
+		{
+			scenario: "empty bitmap",
+			content:  append(append([]byte{payloadBitmap}, id[:bitmapPrefixLength]...), 0, 0, 0, 0),
+			err:      errSetMalformed,
+		},
+		{
+			scenario: "bitmap without its first bit",
+			content:  append(append([]byte{payloadBitmap}, id[:bitmapPrefixLength]...), 0, 0, 0, 1, 2),
+			err:      errSetMalformed,
+		},
+		{
+			scenario: "bitmap padded with zeros",
+			content:  append(append([]byte{payloadBitmap}, id[:bitmapPrefixLength]...), 0, 0, 0, 2, 1, 0),
+			err:      errSetMalformed,
+		},
+		{
+			scenario: "bitmap overflowing the sequence numbers",
+			content:  append(append([]byte{payloadBitmap}, id[:bitmapPrefixLength]...), 0xFF, 0xFF, 0, 1, 3),
+			err:      errSetMalformed,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.scenario, func(t *testing.T) {
+			if err := ValidateCompressedSet(test.content); err != test.err {
+				t.Errorf("bad validation error: expected %v but got %v", test.err, err)
+			}
+
+			n := 0
+			it := CompressedSet(test.content).Iter()
+			for it.Next() {
+				n++
+			}
+
+			if n != test.count {
+				t.Errorf("bad number of KSUIDs before the error: expected %d but got %d", test.count, n)
+			}
+			if err := it.Err(); err != test.err {
+				t.Errorf("bad iterator error: expected %v but got %v", test.err, err)
+			}
+			if it.Next() {
+				t.Error("the iterator must not move forward after an error")
+			}
+		})
+	}
+
+	t.Run("well-formed sets are valid", func(t *testing.T) {
+		ids := makeSequences(1)
+		for i := 0; i < 100; i++ {
+			ids = append(ids, New())
+		}
+
+		for _, set := range []CompressedSet{nil, Compress(New()), Compress(ids...)} {
+			if err := ValidateCompressedSet(set); err != nil {
+				t.Error(err)
+			}
+		}
+	})
+}
+
+func TestCompressedSetRange(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+
+	ids := make([]KSUID, 0, 2000)
+	for i := 0; i < 10; i++ {
+		at := now.Add(time.Duration(i) * time.Hour)
+		seed, _ := NewRandomWithTime(at)
+		seq := Sequence{Seed: seed}
+
+		for j := 0; j < 100; j++ {
+			id, _ := seq.Next()
+			ids = append(ids, id)
+		}
+		for j := 0; j < 100; j++ {
+			id, _ := NewRandomWithTime(at.Add(time.Duration(j%3) * time.Second))
+			ids = append(ids, id)
+		}
+	}
+	Sort(ids)
+
+	set := Compress(ids...)
+
+	filter := func(keep func(KSUID) bool) CompressedSet {
+		var match []KSUID
+		for _, id := range ids {
+			if keep(id) {
+				match = append(match, id)
+			}
+		}
+		return Compress(match...)
+	}
+
+	t.Run("Range", func(t *testing.T) {
+		bounds := [][2]KSUID{
+			{Nil, Max},
+			{Max, Nil},
+			{ids[0], ids[0]},
+			{ids[0].Next(), ids[len(ids)-1].Prev()},
+		}
+		for i := 0; i < len(ids); i += 97 {
+			for j := i; j < len(ids); j += 331 {
+				bounds = append(bounds, [2]KSUID{ids[i], ids[j]}, [2]KSUID{ids[i].Next(), ids[j].Prev()})
+			}
+		}
+
+		for _, b := range bounds {
+			min, max := b[0], b[1]
+			expect := filter(func(id KSUID) bool {
+				return Compare(id, min) >= 0 && Compare(id, max) <= 0
+			})
+
+			if found := set.Range(min, max); !bytes.Equal(found, expect) {
+				t.Errorf("bad range between %s and %s: expected %d KSUIDs but found %d", min, max, expect.Len(), found.Len())
+			}
+		}
+	})
+
+	t.Run("Between", func(t *testing.T) {
+		for i := 0; i < 10; i++ {
+			from := now.Add(time.Duration(i) * time.Hour)
+			to := from.Add(2 * time.Second)
+
+			expect := filter(func(id KSUID) bool {
+				return !id.Time().Before(from) && id.Time().Before(to)
+			})
+
+			found := set.Between(from, to)
+			if !bytes.Equal(found, expect) {
+				t.Errorf("bad range between %s and %s: expected %d KSUIDs but found %d", from, to, expect.Len(), found.Len())
+			}
+			if n := found.Len(); n < 100 || n >= 200 {
+				t.Errorf("unexpected number of KSUIDs between %s and %s: %d", from, to, n)
+			}
+		}
+
+		if found := set.Between(now.Add(time.Hour), now); len(found) != 0 {
+			t.Errorf("found KSUIDs in an empty time range: %s", found)
+		}
+
+		// Times before the epoch of KSUIDs are clamped to it.
+		if found := set.Between(time.Unix(0, 0), now.Add(time.Second)); !bytes.Equal(found, filter(func(id KSUID) bool { return id.Time().Before(now.Add(time.Second)) })) {
+			t.Errorf("bad range from a time before the epoch: found %d KSUIDs", found.Len())
+		}
+		if found := set.Between(time.Unix(0, 0), time.Unix(1, 0)); len(found) != 0 {
+			t.Errorf("found KSUIDs before the epoch: %s", found)
+		}
+	})
+
+	t.Run("MinKSUID and MaxKSUID", func(t *testing.T) {
+		if min := set.MinKSUID(); min != ids[0] {
+			t.Errorf("bad minimum: expected %s but got %s", ids[0], min)
+		}
+		if max := set.MaxKSUID(); max != ids[len(ids)-1] {
+			t.Errorf("bad maximum: expected %s but got %s", ids[len(ids)-1], max)
+		}
+
+		var empty CompressedSet
+		if min, max := empty.MinKSUID(), empty.MaxKSUID(); min != Nil || max != Nil {
+			t.Errorf("the bounds of an empty set must be nil: %s, %s", min, max)
+		}
+	})
+}
+
+func TestCompressedSetRangeBitmapRuns(t *testing.T) {
+	seed, _ := NewRandomWithTime(time.Now().Truncate(time.Second))
+
+	// appendRun appends n contiguous KSUIDs starting at sequence number seq,
+	// the run continues into the next bitmap prefix past the last one.
+	appendRun := func(ids []KSUID, seq uint16, n int) []KSUID {
+		for id := withSequenceNumber(seed, seq); n != 0; n-- {
+			ids = append(ids, id)
+			id = id.Next()
+		}
+		return ids
+	}
+
+	appendSparse := func(ids []KSUID, seq uint16, n int, stride uint16) []KSUID {
+		for ; n != 0; n-- {
+			ids = append(ids, withSequenceNumber(seed, seq))
+			seq += stride
+		}
+		return ids
+	}
+
+	tests := []struct {
+		scenario string
+		ids      []KSUID
+	}{
+		{
+			scenario: "sparse KSUIDs followed by a run",
+			ids:      appendRun(appendSparse(nil, 0, 10, 2), 100, 2000),
+		},
+		{
+			scenario: "a run followed by sparse KSUIDs",
+			ids:      appendSparse(appendRun(nil, 0, 2000), 3000, 10, 2),
+		},
+		{
+			scenario: "runs between sparse KSUIDs",
+			ids:      appendSparse(appendRun(appendSparse(appendRun(appendSparse(nil, 0, 10, 2), 100, 500), 700, 50, 3), 1000, 500), 1600, 10, 2),
+		},
+		{
+			scenario: "a run crossing into the next bitmap prefix",
+			ids:      appendRun(appendSparse(nil, math.MaxUint16-100, 20, 2), math.MaxUint16-50, 1000),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.scenario, func(t *testing.T) {
+			ids := test.ids
+			set := Compress(ids...)
+			first, last := ids[0], ids[len(ids)-1]
+
+			if found := set.Range(first, last); !bytes.Equal(found, set) {
+				t.Errorf("bad range between %s and %s: expected %d KSUIDs but found %d", first, last, len(ids), found.Len())
+			}
+
+			if found := set.Between(first.Time(), first.Time().Add(time.Second)); !bytes.Equal(found, set) {
+				t.Errorf("bad range in the second of %s: expected %d KSUIDs but found %d", first.Time(), len(ids), found.Len())
+			}
+
+			prng := rand.New(rand.NewSource(1))
+
+			for i := 0; i != 1000; i++ {
+				a, b := prng.Intn(len(ids)), prng.Intn(len(ids))
+				if a > b {
+					a, b = b, a
+				}
+
+				if expect, found := Compress(ids[a:b+1]...), set.Range(ids[a], ids[b]); !bytes.Equal(found, expect) {
+					t.Fatalf("bad range between %s and %s: expected %d KSUIDs but found %d", ids[a], ids[b], expect.Len(), found.Len())
+				}
+			}
+		})
+	}
+}
+
+func TestCompressedSetRangeLongRun(t *testing.T) {
+	// A set of a few bytes can hold a range of 2^40 KSUIDs, Range and Between
+	// must carry it over without walking through it.
+	const length = 1 << 40
+
+	first := withSequenceNumber(New(), 0)
+	set := CompressedSet(append([]byte{rawKSUID}, first[:]...))
+	set = append(set, payloadRange|byte(varintLength64(length)))
+	set = appendVarint64(set, length, varintLength64(length))
+	last := set.MaxKSUID()
+
+	tests := []struct {
+		scenario string
+		found    func() CompressedSet
+		first    KSUID
+		last     KSUID
+	}{
+		{
+			scenario: "Range over the whole set",
+			found:    func() CompressedSet { return set.Range(Nil, Max) },
+			first:    first,
+			last:     last,
+		},
+		{
+			scenario: "Range from the middle of the run",
+			found:    func() CompressedSet { return set.Range(first.Next().Next(), Max) },
+			first:    first.Next().Next(),
+			last:     last,
+		},
+		{
+			scenario: "Range to the middle of the run",
+			found:    func() CompressedSet { return set.Range(Nil, first.Next().Next()) },
+			first:    first,
+			last:     first.Next().Next(),
+		},
+		{
+			scenario: "Between",
+			found: func() CompressedSet {
+				return set.Between(first.Time(), first.Time().Add(time.Second))
+			},
+			first: first,
+			last:  last,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.scenario, func(t *testing.T) {
+			found := test.found()
+
+			if it := found.Iter(); !it.Next() || it.KSUID != test.first {
+				t.Errorf("bad first KSUID: expected %s but found %s", test.first, it.KSUID)
+			}
+			if max := found.MaxKSUID(); max != test.last {
+				t.Errorf("bad last KSUID: expected %s but found %s", test.last, max)
+			}
+			if len(found) > len(set) {
+				t.Errorf("the range was expanded: %d bytes instead of at most %d", len(found), len(set))
+			}
+		})
+	}
+}
+
 func reportCompressionRatio(t *testing.T, ksuids []KSUID, set CompressedSet) {
 	len1 := byteLength * len(ksuids)
 	len2 := len(set)
@@ -330,3 +1253,128 @@ func BenchmarkCompressedSet(b *testing.B) {
 		b.SetBytes(int64((n * byteLength) + len(set)))
 	})
 }
+
+var (
+	benchmarkSetsOnce sync.Once
+	benchmarkSetA     CompressedSet
+	benchmarkSetB     CompressedSet
+)
+
+// benchmarkSets returns two sets of a million KSUIDs each, spread over an hour
+// of timestamps and sharing about half of their ids.
+func benchmarkSets() (CompressedSet, CompressedSet) {
+	benchmarkSetsOnce.Do(func() {
+		const count = 1000000
+
+		now := time.Now()
+		ids := make([]KSUID, count*3/2)
+		for i := range ids {
+			ids[i], _ = NewRandomWithTime(now.Add(time.Duration(i%3600) * time.Second))
+		}
+
+		benchmarkSetA = Compress(append([]KSUID{}, ids[:count]...)...)
+		benchmarkSetB = Compress(append([]KSUID{}, ids[count/2:]...)...)
+	})
+	return benchmarkSetA, benchmarkSetB
+}
+
+func BenchmarkCompressedSetAlgebra(b *testing.B) {
+	setA, setB := benchmarkSets()
+
+	benchmarks := []struct {
+		name     string
+		function func(CompressedSet, CompressedSet) CompressedSet
+	}{
+		{name: "union", function: CompressedSet.Union},
+		{name: "intersect", function: CompressedSet.Intersect},
+		{name: "difference", function: CompressedSet.Difference},
+		{name: "symmetric difference", function: CompressedSet.SymmetricDifference},
+	}
+
+	for _, bench := range benchmarks {
+		b.Run(bench.name, func(b *testing.B) {
+			for i := 0; i != b.N; i++ {
+				bench.function(setA, setB)
+			}
+			b.SetBytes(int64(len(setA) + len(setB)))
+		})
+	}
+
+	b.Run("expand sort and compress", func(b *testing.B) {
+		for i := 0; i != b.N; i++ {
+			ids := make([]KSUID, 0, 2000000)
+			for it := setA.Iter(); it.Next(); {
+				ids = append(ids, it.KSUID)
+			}
+			for it := setB.Iter(); it.Next(); {
+				ids = append(ids, it.KSUID)
+			}
+			Sort(ids)
+			Compress(ids...)
+		}
+		b.SetBytes(int64(len(setA) + len(setB)))
+	})
+}
+
+func BenchmarkCompressedSetLen(b *testing.B) {
+	set := Compress(makeSequences(10)...)
+
+	for i := 0; i != b.N; i++ {
+		set.Len()
+	}
+}
+
+func BenchmarkCompressedSetContains(b *testing.B) {
+	ids := makeSequences(10)
+	set := Compress(ids...)
+	id := ids[len(ids)-1]
+
+	for i := 0; i != b.N; i++ {
+		set.Contains(id)
+	}
+}
+
+func BenchmarkCompressedSetSeek(b *testing.B) {
+	set, _ := benchmarkSets()
+
+	ids := make([]KSUID, 0, 1000)
+	for i, it := 0, set.Iter(); it.Next(); i++ {
+		if (i % 1000) == 0 {
+			ids = append(ids, it.KSUID)
+		}
+	}
+
+	b.Run("without index", func(b *testing.B) {
+		for i := 0; i != b.N; i++ {
+			it := set.Iter()
+			it.Seek(ids[i%len(ids)])
+		}
+	})
+
+	b.Run("with index", func(b *testing.B) {
+		index := NewIndexedCompressedSet(set, 0)
+		for i := 0; i != b.N; i++ {
+			it := index.Iter()
+			it.Seek(ids[i%len(ids)])
+		}
+	})
+}
+
+func BenchmarkCompressedSetBitmap(b *testing.B) {
+	for _, k := range []int{1, 2, 4, 8, 16, 64, 256} {
+		ids := makeSparseSequences(10, k)
+
+		b.Run(fmt.Sprintf("1 in %d", k), func(b *testing.B) {
+			var set, ref CompressedSet
+
+			for i := 0; i != b.N; i++ {
+				set = Compress(ids...)
+			}
+
+			ref = compressWithoutBitmaps(ids...)
+			b.ReportMetric(float64(len(set))/float64(len(ids)), "B/id")
+			b.ReportMetric(float64(len(ref))/float64(len(ids)), "B/id-without-bitmaps")
+			b.SetBytes(int64(len(ids) * byteLength))
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package ksuid
+
+import (
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// Shard returns the shard that id belongs to, in the range [0, n), using the
+// jump consistent hash algorithm on the payload of the KSUID. When n grows by
+// one, only 1/n of the KSUIDs move, all to the new shard. Shard returns zero if
+// n is zero.
+//
+// The payload of KSUIDs is random, so hashing their string representation is
+// not necessary to get a uniform distribution.
+func (id KSUID) Shard(n uint32) uint32 {
+	if n == 0 {
+		return 0
+	}
+	return uint32(jumpHash(payloadKey(id), int64(n)))
+}
+
+// payloadKey folds the 128 bits payload of id into a 64 bits key.
+func payloadKey(id KSUID) uint64 {
+	u := uint128Payload(id)
+	return u[0] ^ u[1]
+}
+
+// jumpHash is the algorithm described in "A Fast, Minimal Memory, Consistent
+// Hash Algorithm" by John Lamping and Eric Veach.
+func jumpHash(key uint64, n int64) int64 {
+	b, j := int64(-1), int64(0)
+
+	for j < n {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+
+	return b
+}
+
+// Ring is a consistent hash ring which assigns KSUIDs to named nodes.
+//
+// Each node is placed on the ring at a number of points proportional to its
+// weight, and a KSUID belongs to the node owning the first point that follows
+// the payload of the KSUID on the ring. Adding or removing a node only moves
+// the KSUIDs which belong to that node, and unlike Shard, nodes can be removed
+// from anywhere on the ring and have different weights.
+//
+// Ring values are safe to use concurrently from multiple goroutines.
+type Ring struct {
+	mutex    sync.RWMutex
+	replicas int
+	weights  map[string]int
+	points   []ringPoint // sorted by hash
+}
+
+type ringPoint struct {
+	hash uint64
+	node string
+}
+
+// DefaultRingReplicas is the number of points per unit of weight that nodes
+// are placed at on a Ring created with no explicit number of replicas.
+const DefaultRingReplicas = 128
+
+// NewRing returns an empty Ring which places nodes at replicas points per unit
+// of weight. More points give a more uniform distribution of the KSUIDs at the
+// cost of memory. If replicas is zero or negative, DefaultRingReplicas is used.
+func NewRing(replicas int) *Ring {
+	if replicas <= 0 {
+		replicas = DefaultRingReplicas
+	}
+	return &Ring{
+		replicas: replicas,
+		weights:  make(map[string]int),
+	}
+}
+
+// Add places node on the ring with the given weight, replacing its weight if
+// it was already on the ring. A node with a weight of zero or less is removed.
+func (r *Ring) Add(node string, weight int) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.remove(node)
+
+	if weight <= 0 {
+		return
+	}
+
+	r.weights[node] = weight
+
+	for i := 0; i < weight*r.replicas; i++ {
+		r.points = append(r.points, ringPoint{hash: ringHash(node, i), node: node})
+	}
+
+	sort.Slice(r.points, func(i, j int) bool {
+		p, q := r.points[i], r.points[j]
+		if p.hash != q.hash {
+			return p.hash < q.hash
+		}
+		return p.node < q.node // ensures collisions are resolved in the same way everywhere
+	})
+}
+
+// Remove removes node from the ring.
+func (r *Ring) Remove(node string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.remove(node)
+}
+
+func (r *Ring) remove(node string) {
+	if _, ok := r.weights[node]; !ok {
+		return
+	}
+
+	delete(r.weights, node)
+	points := r.points[:0]
+
+	for _, p := range r.points {
+		if p.node != node {
+			points = append(points, p)
+		}
+	}
+
+	r.points = points
+}
+
+// Node returns the node that id belongs to, or an empty string if the ring has
+// no nodes.
+func (r *Ring) Node(id KSUID) string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	if len(r.points) == 0 {
+		return ""
+	}
+
+	key := payloadKey(id)
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i].hash >= key })
+
+	if i == len(r.points) {
+		i = 0
+	}
+
+	return r.points[i].node
+}
+
+// Weight returns the weight of node, or zero if it is not on the ring.
+func (r *Ring) Weight(node string) int {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.weights[node]
+}
+
+// ringHash returns the position of the i-th point of node on the ring.
+func ringHash(node string, i int) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(node))
+	h.Write([]byte{'#'})
+	h.Write(strconv.AppendInt(nil, int64(i), 10))
+	return mix64(h.Sum64())
+}
+
+// mix64 is the finalizer of the splitmix64 generator, FNV hashes of strings
+// which differ only in their last bytes are not spread well enough over the
+// ring without it.
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
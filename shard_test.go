@@ -0,0 +1,203 @@
+package ksuid
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// makeShardInput returns n KSUIDs with random payloads, generated from a fixed
+// seed so the distribution tests are deterministic.
+func makeShardInput(n int) []KSUID {
+	prng := rand.New(rand.NewSource(1))
+	ids := make([]KSUID, n)
+	for i := range ids {
+		prng.Read(ids[i][:])
+	}
+	return ids
+}
+
+func TestShard(t *testing.T) {
+	ids := makeShardInput(100000)
+
+	t.Run("KSUIDs are distributed uniformly", func(t *testing.T) {
+		for _, n := range []uint32{1, 2, 10, 100} {
+			counts := make([]int, n)
+			for _, id := range ids {
+				s := id.Shard(n)
+				if s >= n {
+					t.Fatalf("shard %d out of range [0, %d)", s, n)
+				}
+				counts[s]++
+			}
+			testUniformDistribution(t, counts, len(ids))
+		}
+	})
+
+	t.Run("growing the number of shards moves KSUIDs to the new shard", func(t *testing.T) {
+		for _, n := range []uint32{1, 9, 99} {
+			moved := 0
+
+			for _, id := range ids {
+				if a, b := id.Shard(n), id.Shard(n+1); a != b {
+					if b != n {
+						t.Fatalf("KSUID %s moved from shard %d to shard %d instead of %d", id, a, b, n)
+					}
+					moved++
+				}
+			}
+
+			expect := float64(len(ids)) / float64(n+1)
+			if math.Abs(float64(moved)-expect) > 0.05*expect {
+				t.Errorf("growing from %d to %d shards moved %d KSUIDs instead of about %.0f", n, n+1, moved, expect)
+			}
+		}
+	})
+
+	t.Run("zero shards", func(t *testing.T) {
+		if s := ids[0].Shard(0); s != 0 {
+			t.Errorf("expected shard zero but got %d", s)
+		}
+	})
+}
+
+func TestRing(t *testing.T) {
+	ids := makeShardInput(100000)
+
+	t.Run("an empty ring has no nodes", func(t *testing.T) {
+		if node := NewRing(0).Node(ids[0]); node != "" {
+			t.Errorf("expected no node but got %q", node)
+		}
+	})
+
+	t.Run("KSUIDs are distributed according to the weights", func(t *testing.T) {
+		r := NewRing(0)
+		r.Add("A", 1)
+		r.Add("B", 2)
+		r.Add("C", 1)
+
+		counts := map[string]int{}
+		for _, id := range ids {
+			counts[r.Node(id)]++
+		}
+
+		for node, share := range map[string]float64{"A": 0.25, "B": 0.5, "C": 0.25} {
+			if f := float64(counts[node]) / float64(len(ids)); math.Abs(f-share) > 0.2*share {
+				t.Errorf("node %s received %.3f of the KSUIDs instead of about %.3f", node, f, share)
+			}
+		}
+	})
+
+	t.Run("adding and removing nodes only moves their KSUIDs", func(t *testing.T) {
+		r := NewRing(0)
+		for _, node := range []string{"A", "B", "C", "D"} {
+			r.Add(node, 1)
+		}
+
+		before := make([]string, len(ids))
+		for i, id := range ids {
+			before[i] = r.Node(id)
+		}
+
+		r.Add("E", 1)
+		moved := 0
+
+		for i, id := range ids {
+			if node := r.Node(id); node != before[i] {
+				if node != "E" {
+					t.Fatalf("KSUID %s moved from node %s to node %s", id, before[i], node)
+				}
+				moved++
+			}
+		}
+
+		if f := float64(moved) / float64(len(ids)); math.Abs(f-0.2) > 0.2*0.2 {
+			t.Errorf("adding a fifth node moved %.3f of the KSUIDs instead of about 0.2", f)
+		}
+
+		r.Remove("E")
+		r.Remove("B")
+
+		for i, id := range ids {
+			if node := r.Node(id); node != before[i] && before[i] != "B" {
+				t.Fatalf("KSUID %s moved from node %s to node %s", id, before[i], node)
+			}
+		}
+
+		if w := r.Weight("B"); w != 0 {
+			t.Errorf("node B still has a weight of %d after being removed", w)
+		}
+	})
+
+	t.Run("changing the weight of a node replaces its points", func(t *testing.T) {
+		r := NewRing(10)
+		r.Add("A", 3)
+		r.Add("A", 1)
+
+		if n := len(r.points); n != 10 {
+			t.Errorf("expected 10 points on the ring but found %d", n)
+		}
+		if w := r.Weight("A"); w != 1 {
+			t.Errorf("expected a weight of 1 but got %d", w)
+		}
+
+		r.Add("A", 0)
+
+		if node := r.Node(ids[0]); node != "" {
+			t.Errorf("expected no node but got %q", node)
+		}
+	})
+
+	t.Run("nodes can be looked up while the ring changes", func(t *testing.T) {
+		r := NewRing(0)
+		r.Add("A", 1)
+		done := make(chan struct{})
+
+		go func() {
+			defer close(done)
+			for i := 0; i < 100; i++ {
+				r.Add("B", i%3)
+			}
+		}()
+
+		for _, id := range ids[:10000] {
+			if node := r.Node(id); node != "A" && node != "B" {
+				t.Fatalf("unexpected node %q", node)
+			}
+		}
+
+		<-done
+	})
+}
+
+func testUniformDistribution(t *testing.T, counts []int, total int) {
+	t.Helper()
+	expect := float64(total) / float64(len(counts))
+
+	for i, n := range counts {
+		if math.Abs(float64(n)-expect) > 0.1*expect {
+			t.Errorf("shard %d of %d received %d KSUIDs instead of about %.0f", i, len(counts), n, expect)
+		}
+	}
+}
+
+func BenchmarkShard(b *testing.B) {
+	id := New()
+
+	for i := 0; i != b.N; i++ {
+		id.Shard(1000)
+	}
+}
+
+func BenchmarkRing(b *testing.B) {
+	id := New()
+	r := NewRing(0)
+
+	for _, node := range []string{"A", "B", "C", "D", "E", "F", "G", "H"} {
+		r.Add(node, 1)
+	}
+
+	for i := 0; i != b.N; i++ {
+		r.Node(id)
+	}
+}
@@ -0,0 +1,167 @@
+package ksuid
+
+import (
+	"bytes"
+	"runtime"
+	"sync"
+)
+
+// Below this number of KSUIDs, radix sort buckets are sorted with an insertion
+// sort, which is faster than counting and permuting bytes on small inputs.
+const insertionSortThreshold = 32
+
+// Below this number of KSUIDs per worker, ParallelSort does not spawn more
+// goroutines, the cost of synchronization would not be amortized.
+const parallelSortMinLength = 16384
+
+// ParallelSort sorts the given slice of KSUIDs using up to workers goroutines.
+// If workers is zero or negative, runtime.GOMAXPROCS(0) is used.
+//
+// The slice is split in one chunk per worker, each chunk is sorted with Sort,
+// then the chunks are merged pairwise until a single one is left. Merging uses
+// a temporary buffer of the same size as ids.
+func ParallelSort(ids []KSUID, workers int) {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	if n := len(ids) / parallelSortMinLength; workers > n {
+		workers = n
+	}
+
+	if workers < 2 {
+		Sort(ids)
+		return
+	}
+
+	bounds := make([]int, workers+1)
+	for i := range bounds {
+		bounds[i] = (len(ids) * i) / workers
+	}
+
+	wg := sync.WaitGroup{}
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(chunk []KSUID) {
+			Sort(chunk)
+			wg.Done()
+		}(ids[bounds[i]:bounds[i+1]])
+	}
+
+	wg.Wait()
+
+	src, dst := ids, make([]KSUID, len(ids))
+
+	for len(bounds) > 2 {
+		merged := bounds[:1]
+
+		for i := 0; i+1 < len(bounds); i += 2 {
+			if i+2 == len(bounds) { // odd number of chunks
+				copy(dst[bounds[i]:], src[bounds[i]:bounds[i+1]])
+				merged = append(merged, bounds[i+1])
+				break
+			}
+
+			lo, mid, hi := bounds[i], bounds[i+1], bounds[i+2]
+			wg.Add(1)
+			go func() {
+				mergeSorted(dst[lo:lo], src[lo:mid], src[mid:hi])
+				wg.Done()
+			}()
+			merged = append(merged, hi)
+		}
+
+		wg.Wait()
+		bounds = merged
+		src, dst = dst, src
+	}
+
+	if &src[0] != &ids[0] {
+		copy(ids, src)
+	}
+}
+
+// mergeSorted appends the KSUIDs of the sorted slices a and b to dst, in order.
+func mergeSorted(dst, a, b []KSUID) []KSUID {
+	for len(a) != 0 && len(b) != 0 {
+		if bytes.Compare(b[0][:], a[0][:]) < 0 {
+			dst, b = append(dst, b[0]), b[1:]
+		} else {
+			dst, a = append(dst, a[0]), a[1:]
+		}
+	}
+	dst = append(dst, a...)
+	dst = append(dst, b...)
+	return dst
+}
+
+// radixSort sorts a in place, using the bytes of the KSUIDs starting at index
+// d as keys. It implements an MSD radix sort which permutes KSUIDs between
+// buckets without allocating memory (also known as American flag sort), and
+// recurses at most once per byte.
+func radixSort(a []KSUID, d int) {
+	for len(a) > insertionSortThreshold && d < byteLength {
+		var counts [256]int
+		for i := range a {
+			counts[a[i][d]]++
+		}
+
+		// All KSUIDs have the same byte at this index, which is common in the
+		// timestamp of KSUIDs generated close to each other, there is nothing
+		// to permute so we can go straight to the next byte.
+		if counts[a[0][d]] == len(a) {
+			d++
+			continue
+		}
+
+		var heads, tails [256]int
+		offset := 0
+		for b, n := range counts {
+			heads[b] = offset
+			offset += n
+			tails[b] = offset
+		}
+
+		for b := range heads {
+			for heads[b] < tails[b] {
+				id := a[heads[b]]
+				// Follow the cycle of KSUIDs that belong to other buckets
+				// until one belonging to b is found.
+				for c := id[d]; int(c) != b; c = id[d] {
+					a[heads[c]], id = id, a[heads[c]]
+					heads[c]++
+				}
+				a[heads[b]] = id
+				heads[b]++
+			}
+		}
+
+		offset = 0
+		for _, n := range counts {
+			if n > 1 {
+				radixSort(a[offset:offset+n], d+1)
+			}
+			offset += n
+		}
+		return
+	}
+
+	if d < byteLength {
+		insertionSort(a, d)
+	}
+}
+
+// insertionSort sorts a in place, assuming the KSUIDs have the same bytes
+// before index d.
+func insertionSort(a []KSUID, d int) {
+	for i := 1; i < len(a); i++ {
+		id := a[i]
+		j := i
+		for j > 0 && bytes.Compare(id[d:], a[j-1][d:]) < 0 {
+			a[j] = a[j-1]
+			j--
+		}
+		a[j] = id
+	}
+}
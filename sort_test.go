@@ -0,0 +1,154 @@
+package ksuid
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+// sortInputs returns generators of n KSUIDs in the orders that sorting
+// algorithms commonly handle badly.
+func sortInputs() []struct {
+	scenario string
+	generate func(n int) []KSUID
+} {
+	return []struct {
+		scenario string
+		generate func(n int) []KSUID
+	}{
+		{
+			scenario: "random",
+			generate: func(n int) []KSUID {
+				prng := rand.New(rand.NewSource(int64(n)))
+				ids := make([]KSUID, n)
+				for i := range ids {
+					prng.Read(ids[i][:])
+				}
+				return ids
+			},
+		},
+		{
+			scenario: "new",
+			generate: func(n int) []KSUID {
+				ids := make([]KSUID, n)
+				for i := range ids {
+					ids[i] = New()
+				}
+				return ids
+			},
+		},
+		{
+			scenario: "sorted",
+			generate: func(n int) []KSUID {
+				ids := make([]KSUID, n)
+				seq := Sequence{Seed: New()}
+				for i := range ids {
+					if i%65536 == 0 {
+						seq = Sequence{Seed: New()}
+					}
+					ids[i], _ = seq.Next()
+				}
+				sort.Slice(ids, func(i, j int) bool { return Compare(ids[i], ids[j]) < 0 })
+				return ids
+			},
+		},
+		{
+			scenario: "reversed",
+			generate: func(n int) []KSUID {
+				ids := make([]KSUID, n)
+				id := New()
+				for i := range ids {
+					ids[len(ids)-i-1] = id
+					id = id.Next()
+				}
+				return ids
+			},
+		},
+		{
+			scenario: "duplicates",
+			generate: func(n int) []KSUID {
+				prng := rand.New(rand.NewSource(int64(n)))
+				set := [10]KSUID{}
+				for i := range set {
+					set[i] = New()
+				}
+				ids := make([]KSUID, n)
+				for i := range ids {
+					ids[i] = set[prng.Intn(len(set))]
+				}
+				return ids
+			},
+		},
+	}
+}
+
+func TestSortInputs(t *testing.T) {
+	for _, input := range sortInputs() {
+		for _, n := range []int{0, 1, 2, insertionSortThreshold + 1, 1000, 2*parallelSortMinLength + 1, 3*parallelSortMinLength + 1} {
+			ids := input.generate(n)
+			expect := append([]KSUID{}, ids...)
+			sort.Slice(expect, func(i, j int) bool { return Compare(expect[i], expect[j]) < 0 })
+
+			t.Run(fmt.Sprintf("Sort %s %d", input.scenario, n), func(t *testing.T) {
+				testSort(t, expect, ids, Sort)
+			})
+
+			for _, workers := range []int{0, 1, 2, 3} {
+				t.Run(fmt.Sprintf("ParallelSort %s %d with %d workers", input.scenario, n, workers), func(t *testing.T) {
+					testSort(t, expect, ids, func(ids []KSUID) { ParallelSort(ids, workers) })
+				})
+			}
+		}
+	}
+}
+
+func testSort(t *testing.T, expect []KSUID, ids []KSUID, sortFunc func([]KSUID)) {
+	ids = append([]KSUID{}, ids...)
+	sortFunc(ids)
+
+	if !IsSorted(ids) {
+		t.Fatal("not sorted")
+	}
+
+	for i := range ids {
+		if ids[i] != expect[i] {
+			t.Fatalf("bad KSUID at index %d: expected %s but found %s", i, expect[i], ids[i])
+		}
+	}
+}
+
+func BenchmarkSortInputs(b *testing.B) {
+	const n = 1000000
+
+	for _, input := range sortInputs() {
+		ids := input.generate(n)
+		tmp := make([]KSUID, n)
+
+		b.Run(input.scenario, func(b *testing.B) {
+			b.Run("Sort", func(b *testing.B) {
+				for i := 0; i != b.N; i++ {
+					copy(tmp, ids)
+					Sort(tmp)
+				}
+				b.SetBytes(n * byteLength)
+			})
+
+			b.Run("ParallelSort", func(b *testing.B) {
+				for i := 0; i != b.N; i++ {
+					copy(tmp, ids)
+					ParallelSort(tmp, 0)
+				}
+				b.SetBytes(n * byteLength)
+			})
+
+			b.Run("sort.Slice", func(b *testing.B) {
+				for i := 0; i != b.N; i++ {
+					copy(tmp, ids)
+					sort.Slice(tmp, func(i, j int) bool { return Compare(tmp[i], tmp[j]) < 0 })
+				}
+				b.SetBytes(n * byteLength)
+			})
+		})
+	}
+}